@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertQueueSize is how many alerts a sink may have waiting before the
+// next ones are dropped, so that a slow sink never blocks monitoring.
+const alertQueueSize = 1000
+
+// alert is a match reported to the sinks. Digests summarize the matches of
+// a rule over an interval, with Count set.
+type alert struct {
+	Time     time.Time `json:"time"`
+	Host     string    `json:"host"`
+	File     string    `json:"file,omitempty"`
+	Rule     string    `json:"rule"`
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+	Lines    []string  `json:"lines,omitempty"`
+	Count    int       `json:"count,omitempty"`
+}
+
+func (a alert) text() string {
+	if a.File == "" {
+		return fmt.Sprintf("[%s/%s] %s", a.Rule, a.Severity, a.Message)
+	}
+	return fmt.Sprintf("%s: [%s/%s] %s", a.File, a.Rule, a.Severity, a.Message)
+}
+
+// alertConfig is the JSON file given with -alerts.
+type alertConfig struct {
+	DedupWindow    string       `json:"dedup_window"`
+	DigestInterval string       `json:"digest_interval"`
+	Sinks          []sinkConfig `json:"sinks"`
+}
+
+// sinkConfig describes a sink. Type selects which of the other fields are
+// used: path for file; network, address and tag for syslog; url, headers
+// and timeout for webhook; address, from, to, username and password_env for
+// smtp. Severities restricts the sink to these severities, all when empty.
+// RateLimit such as "10/1m" caps the alerts sent by the sink, the others
+// being summarized in the digest.
+type sinkConfig struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Severities  []string          `json:"severities"`
+	RateLimit   string            `json:"rate_limit"`
+	Path        string            `json:"path"`
+	Network     string            `json:"network"`
+	Address     string            `json:"address"`
+	Tag         string            `json:"tag"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Timeout     string            `json:"timeout"`
+	From        string            `json:"from"`
+	To          []string          `json:"to"`
+	Username    string            `json:"username"`
+	PasswordEnv string            `json:"password_env"`
+}
+
+// alertSink delivers alerts somewhere.
+type alertSink interface {
+	send(a alert) error
+	close() error
+}
+
+// alerter deduplicates the matches and fans them out to the sinks.
+type alerter struct {
+	host        string
+	dedupWindow time.Duration
+	sinks       []*sinkRunner
+	wg          sync.WaitGroup
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// sinkRunner sends the alerts of one sink from its own goroutine, applying
+// its rate limit and sending its digests.
+type sinkRunner struct {
+	name       string
+	sink       alertSink
+	severities map[string]bool
+	limit      *rateLimit
+	digest     time.Duration
+	host       string
+	queue      chan queuedAlert
+
+	// The matches and the suppressed alerts of each rule since the last
+	// digest, only used by the goroutine of the sink.
+	matched    map[string]int
+	suppressed map[string]int
+	severity   map[string]string
+}
+
+// queuedAlert is an alert waiting for a sink. Duplicates are only counted
+// in the digest.
+type queuedAlert struct {
+	alert
+	duplicate bool
+}
+
+// loadAlerter reads an alerts file and starts its sinks.
+func loadAlerter(path string) (*alerter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config alertConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if len(config.Sinks) == 0 {
+		return nil, fmt.Errorf("%s does not define any sink", path)
+	}
+	dedup, err := parseConfigDuration(config.DedupWindow, 5*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dedup_window in %s: %v", path, err)
+	}
+	digest, err := parseConfigDuration(config.DigestInterval, 5*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest_interval in %s: %v", path, err)
+	}
+
+	host, _ := os.Hostname()
+	a := &alerter{host: host, dedupWindow: dedup, lastSent: make(map[string]time.Time)}
+	for i, sc := range config.Sinks {
+		if sc.Name == "" {
+			sc.Name = fmt.Sprintf("%s%d", sc.Type, i+1)
+		}
+		runner, err := newSinkRunner(sc, digest, host)
+		if err != nil {
+			a.close()
+			return nil, fmt.Errorf("sink %s in %s: %v", sc.Name, path, err)
+		}
+		a.sinks = append(a.sinks, runner)
+		a.wg.Add(1)
+		go runner.run(&a.wg)
+	}
+	return a, nil
+}
+
+func parseConfigDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("%s is not positive", s)
+	}
+	return d, err
+}
+
+func newSinkRunner(sc sinkConfig, digest time.Duration, host string) (*sinkRunner, error) {
+	runner := &sinkRunner{
+		name:       sc.Name,
+		digest:     digest,
+		host:       host,
+		queue:      make(chan queuedAlert, alertQueueSize),
+		matched:    make(map[string]int),
+		suppressed: make(map[string]int),
+		severity:   make(map[string]string),
+	}
+	if len(sc.Severities) > 0 {
+		runner.severities = make(map[string]bool)
+		for _, severity := range sc.Severities {
+			if severityRank(severity) < 0 {
+				return nil, fmt.Errorf("invalid severity %q, expected one of %v", severity, severities)
+			}
+			runner.severities[severity] = true
+		}
+	}
+	if sc.RateLimit != "" {
+		limit, err := parseRateLimit(sc.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		runner.limit = limit
+	}
+
+	var err error
+	switch sc.Type {
+	case "file":
+		runner.sink, err = newFileSink(sc)
+	case "syslog":
+		runner.sink, err = newSyslogSink(sc)
+	case "webhook":
+		runner.sink, err = newWebhookSink(sc)
+	case "smtp":
+		runner.sink, err = newSMTPSink(sc)
+	default:
+		err = fmt.Errorf("unknown type %q, expected file, syslog, webhook or smtp", sc.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+// alert reports a match to the sinks taking its severity. A message
+// already reported within the dedup window is only counted in the digests,
+// the timestamps of the lines being ignored when comparing messages.
+func (a *alerter) alert(file, rule, severity string, lines []string) {
+	now := time.Now()
+	key := file + "\x00" + rule + "\x00" + stripLogTimestamp(lines[0])
+	a.mu.Lock()
+	last, seen := a.lastSent[key]
+	duplicate := seen && now.Sub(last) < a.dedupWindow
+	if !duplicate {
+		a.lastSent[key] = now
+	}
+	// Forget the expired messages now and then.
+	if len(a.lastSent) > 10000 {
+		for k, t := range a.lastSent {
+			if now.Sub(t) >= a.dedupWindow {
+				delete(a.lastSent, k)
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	al := queuedAlert{
+		alert:     alert{Time: now, Host: a.host, File: file, Rule: rule, Severity: severity, Message: lines[0], Lines: lines[1:]},
+		duplicate: duplicate,
+	}
+	for _, runner := range a.sinks {
+		if runner.severities != nil && !runner.severities[severity] {
+			continue
+		}
+		select {
+		case runner.queue <- al:
+		default:
+			writeLog(logfile, fmt.Sprintf("Alert queue of sink %s is full, dropping an alert of rule %s\n", runner.name, rule))
+		}
+	}
+}
+
+// close sends the pending digests and closes the sinks.
+func (a *alerter) close() {
+	for _, runner := range a.sinks {
+		close(runner.queue)
+	}
+	a.wg.Wait()
+}
+
+func (runner *sinkRunner) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer runner.sink.close()
+	ticker := time.NewTicker(runner.digest)
+	defer ticker.Stop()
+	for {
+		select {
+		case al, ok := <-runner.queue:
+			if !ok {
+				runner.sendDigest()
+				return
+			}
+			runner.matched[al.Rule]++
+			runner.severity[al.Rule] = al.Severity
+			if al.duplicate || (runner.limit != nil && !runner.limit.allow(time.Now())) {
+				runner.suppressed[al.Rule]++
+				continue
+			}
+			runner.deliver(al.alert)
+		case <-ticker.C:
+			runner.sendDigest()
+		}
+	}
+}
+
+// sendDigest summarizes the rules some alerts of which were suppressed
+// since the last digest. Digests are not rate limited.
+func (runner *sinkRunner) sendDigest() {
+	var rules []string
+	for rule := range runner.suppressed {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		runner.deliver(alert{
+			Time:     time.Now(),
+			Host:     runner.host,
+			Rule:     rule,
+			Severity: runner.severity[rule],
+			Message:  fmt.Sprintf("rule %s matched %d times in %v", rule, runner.matched[rule], runner.digest),
+			Count:    runner.matched[rule],
+		})
+	}
+	runner.matched = make(map[string]int)
+	runner.suppressed = make(map[string]int)
+}
+
+func (runner *sinkRunner) deliver(al alert) {
+	if err := runner.sink.send(al); err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to send alert to sink %s: %v\n", runner.name, err))
+	}
+}
+
+// rateLimit is a token bucket allowing n alerts per period.
+type rateLimit struct {
+	n      float64
+	period time.Duration
+	tokens float64
+	last   time.Time
+}
+
+// parseRateLimit parses "n/period" such as "10/1m" or "100/h".
+func parseRateLimit(s string) (*rateLimit, error) {
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid rate_limit %q, expected n/period such as 10/1m", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid rate_limit %q, expected n/period such as 10/1m", s)
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid rate_limit %q, expected n/period such as 10/1m", s)
+	}
+	return &rateLimit{n: float64(n), period: d, tokens: float64(n)}, nil
+}
+
+func (limit *rateLimit) allow(now time.Time) bool {
+	if !limit.last.IsZero() {
+		limit.tokens += now.Sub(limit.last).Seconds() / limit.period.Seconds() * limit.n
+		if limit.tokens > limit.n {
+			limit.tokens = limit.n
+		}
+	}
+	limit.last = now
+	if limit.tokens < 1 {
+		return false
+	}
+	limit.tokens--
+	return true
+}
+
+// fileSink appends the alerts to a file in JSON Lines.
+type fileSink struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newFileSink(sc sinkConfig) (alertSink, error) {
+	if sc.Path == "" {
+		return nil, fmt.Errorf("no path")
+	}
+	file, err := os.OpenFile(sc.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (s *fileSink) send(a alert) error {
+	return s.enc.Encode(a)
+}
+
+func (s *fileSink) close() error {
+	return s.file.Close()
+}
+
+// syslogSink writes the alerts to the local or a remote syslog, with the
+// priority of their severity.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink(sc sinkConfig) (alertSink, error) {
+	tag := sc.Tag
+	if tag == "" {
+		tag = "pac_weiyu"
+	}
+	writer, err := syslog.Dial(sc.Network, sc.Address, syslog.LOG_WARNING|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) send(a alert) error {
+	switch a.Severity {
+	case "critical":
+		return s.writer.Crit(a.text())
+	case "error":
+		return s.writer.Err(a.text())
+	case "warning":
+		return s.writer.Warning(a.text())
+	default:
+		return s.writer.Info(a.text())
+	}
+}
+
+func (s *syslogSink) close() error {
+	return s.writer.Close()
+}
+
+// webhookSink posts each alert as a JSON object.
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhookSink(sc sinkConfig) (alertSink, error) {
+	if sc.URL == "" {
+		return nil, fmt.Errorf("no url")
+	}
+	timeout, err := parseConfigDuration(sc.Timeout, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout: %v", err)
+	}
+	return &webhookSink{url: sc.URL, headers: sc.Headers, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (s *webhookSink) send(a alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) close() error {
+	return nil
+}
+
+// smtpSink mails each alert. The password is read from the environment
+// variable named by password_env rather than from the configuration.
+type smtpSink struct {
+	address string
+	from    string
+	to      []string
+	auth    smtp.Auth
+}
+
+func newSMTPSink(sc sinkConfig) (alertSink, error) {
+	if sc.Address == "" || sc.From == "" || len(sc.To) == 0 {
+		return nil, fmt.Errorf("address, from and to are required")
+	}
+	s := &smtpSink{address: sc.Address, from: sc.From, to: sc.To}
+	if sc.Username != "" {
+		host := sc.Address
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		s.auth = smtp.PlainAuth("", sc.Username, os.Getenv(sc.PasswordEnv), host)
+	}
+	return s, nil
+}
+
+func (s *smtpSink) send(a alert) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: [pac_weiyu] %s %s on %s\r\n", a.Severity, a.Rule, a.Host)
+	fmt.Fprintf(&msg, "Date: %s\r\n\r\n", a.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "%s\r\n", a.text())
+	for _, line := range a.Lines {
+		fmt.Fprintf(&msg, "    %s\r\n", line)
+	}
+	return smtp.SendMail(s.address, s.auth, s.from, s.to, msg.Bytes())
+}
+
+func (s *smtpSink) close() error {
+	return nil
+}
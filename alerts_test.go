@@ -0,0 +1,160 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		n       float64
+		period  time.Duration
+		wantErr bool
+	}{
+		{"10/1m", 10, time.Minute, false},
+		{"100/h", 100, time.Hour, false},
+		{"3/30s", 3, 30 * time.Second, false},
+		{"10", 0, 0, true},
+		{"0/1m", 0, 0, true},
+		{"x/1m", 0, 0, true},
+		{"10/", 0, 0, true},
+		{"10/0s", 0, 0, true},
+		{"10/fortnight", 0, 0, true},
+	}
+	for _, tt := range tests {
+		limit, err := parseRateLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRateLimit(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (limit.n != tt.n || limit.period != tt.period || limit.tokens != tt.n) {
+			t.Errorf("parseRateLimit(%q) = %+v, want %v per %v", tt.in, *limit, tt.n, tt.period)
+		}
+	}
+}
+
+func TestRateLimitAllow(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		limit string
+		// at are the times of the alerts after start, want whether each is
+		// allowed.
+		at   []time.Duration
+		want []bool
+	}{
+		{"burst", "3/1m", []time.Duration{0, 0, 0, 0}, []bool{true, true, true, false}},
+		{"refill", "2/1m", []time.Duration{0, 0, 0, 30 * time.Second, 31 * time.Second, 90 * time.Second}, []bool{true, true, false, true, false, true}},
+		{"capped refill", "2/1m", []time.Duration{0, 0, time.Hour, time.Hour, time.Hour}, []bool{true, true, true, true, false}},
+	}
+	for _, tt := range tests {
+		limit, err := parseRateLimit(tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, at := range tt.at {
+			if got := limit.allow(start.Add(at)); got != tt.want[i] {
+				t.Errorf("%s: alert %d at %v allowed = %v, want %v", tt.name, i+1, at, got, tt.want[i])
+			}
+		}
+	}
+}
+
+// recordingSink keeps the alerts it is sent.
+type recordingSink struct {
+	mu     sync.Mutex
+	alerts []alert
+}
+
+func (s *recordingSink) send(a alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, a)
+	return nil
+}
+
+func (s *recordingSink) close() error {
+	return nil
+}
+
+func TestAlerterDedup(t *testing.T) {
+	tests := []struct {
+		name   string
+		window time.Duration
+		limit  string
+		lines  []string
+		// want are the messages delivered, digests included.
+		want []string
+	}{
+		{"same message", time.Hour, "", []string{"ERROR db down", "ERROR db down"},
+			[]string{"ERROR db down", "rule r matched 2 times in 1h0m0s"}},
+		{"timestamps differ", time.Hour, "", []string{
+			"2024-05-01 12:00:00,001 ERROR db down",
+			"2024-05-01 12:00:05,123 ERROR db down",
+			"[2024-05-01T12:00:09Z] ERROR db down",
+		}, []string{"2024-05-01 12:00:00,001 ERROR db down", "rule r matched 3 times in 1h0m0s"}},
+		{"syslog timestamps differ", time.Hour, "", []string{"May  1 12:00:00 host app: failed", "May  1 12:01:00 host app: failed"},
+			[]string{"May  1 12:00:00 host app: failed", "rule r matched 2 times in 1h0m0s"}},
+		{"messages differ", time.Hour, "", []string{"2024-05-01 12:00:00 ERROR db down", "2024-05-01 12:00:01 ERROR disk full"},
+			[]string{"2024-05-01 12:00:00 ERROR db down", "2024-05-01 12:00:01 ERROR disk full"}},
+		{"window expired", time.Nanosecond, "", []string{"ERROR db down", "ERROR db down"},
+			[]string{"ERROR db down", "ERROR db down"}},
+		{"rate limited", time.Hour, "1/1h", []string{"ERROR a", "ERROR b", "ERROR c"},
+			[]string{"ERROR a", "rule r matched 3 times in 1h0m0s"}},
+	}
+	for _, tt := range tests {
+		sink := &recordingSink{}
+		runner, err := newSinkRunner(sinkConfig{Name: "test", Type: "file", Path: t.TempDir() + "/alerts.jsonl", RateLimit: tt.limit}, time.Hour, "host")
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner.sink.close()
+		runner.sink = sink
+		a := &alerter{host: "host", dedupWindow: tt.window, sinks: []*sinkRunner{runner}, lastSent: make(map[string]time.Time)}
+		a.wg.Add(1)
+		go runner.run(&a.wg)
+		for _, line := range tt.lines {
+			if tt.window == time.Nanosecond {
+				time.Sleep(time.Millisecond)
+			}
+			a.alert("app.log", "r", "error", []string{line})
+		}
+		a.close()
+
+		var got []string
+		for _, al := range sink.alerts {
+			got = append(got, al.Message)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: delivered %q, want %q", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: delivered %q, want %q", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestStripLogTimestamp(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"2024-05-01 12:00:00,123 ERROR db down", "ERROR db down"},
+		{"[2024-05-01T12:00:00.5+02:00] ERROR db down", "ERROR db down"},
+		{"2024/05/01 12:00:00 failed", "failed"},
+		{"May  1 12:00:00 host app: failed", "host app: failed"},
+		{"ERROR no timestamp", "ERROR no timestamp"},
+		{"2024-99-99 12:00:00 not a date", "2024-99-99 12:00:00 not a date"},
+	}
+	for _, tt := range tests {
+		if got := stripLogTimestamp(tt.line); got != tt.want {
+			t.Errorf("stripLogTimestamp(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
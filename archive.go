@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// gzipMagic starts every gzip stream, whatever the name of the file.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressedLogFile closes the gzip stream and the file under it.
+type compressedLogFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *compressedLogFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// openLogFile opens a log file for reading, decompressing it on the fly
+// when it is gzip-compressed.
+func openLogFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(file)
+	magic, _ := br.Peek(len(gzipMagic))
+	if string(magic) != string(gzipMagic) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, file}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %v", path, err)
+	}
+	return &compressedLogFile{Reader: gz, file: file}, nil
+}
+
+// isCompressedLog reports whether the file at path is gzip-compressed.
+func isCompressedLog(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(gzipMagic))
+	n, _ := io.ReadFull(file, magic)
+	return n == len(gzipMagic) && string(magic) == string(gzipMagic)
+}
+
+// rotationSuffix matches the suffixes added by logrotate and the logging
+// libraries to rotated logs: a counter or a date, possibly with a time.
+var rotationSuffix = regexp.MustCompile(`(?:\.\d+|[.-]\d{4}-?\d{2}-?\d{2}(?:[-_]?\d{2,6})?)$`)
+
+// trimArchiveSuffix returns the name of a log file without its .gz
+// extension and its rotation suffix, such as the ".1" of app.log.1.gz or
+// the "-20240501" of app.log-20240501, so that the globs written for the
+// plain logs also match their rotations.
+func trimArchiveSuffix(name string) string {
+	return rotationSuffix.ReplaceAllString(strings.TrimSuffix(name, ".gz"), "")
+}
+
+func parseScanOptions(args []string) (monitorOptions, error) {
+	var opts monitorOptions
+	fs := flag.NewFlagSet("scanLogs", flag.ContinueOnError)
+	addMatchFlags(fs, &opts, "")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	err := validateMatchOptions(&opts)
+	return opts, err
+}
+
+// scanLogs applies the match rules once to every file under dir, plain or
+// gzip-compressed, and prints the matches like monitorLogs. The offsets of
+// the matches of a compressed file are offsets in its decompressed content.
+// The files and directories that cannot be read are reported and skipped.
+func scanLogs(dir string, opts monitorOptions) error {
+	rules, err := loadMatchRules(opts)
+	if err != nil {
+		return fmt.Errorf("failed to load rules: %v", err)
+	}
+	host, _ := os.Hostname()
+
+	var files []string
+	failed := 0
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			failed++
+			writeLog(logfile, fmt.Sprintf("Failed to scan %s: %v\n", path, err))
+			fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", path, err)
+			return nil
+		}
+		if !info.IsDir() && opts.selects(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	matches := 0
+	for _, path := range files {
+		n, err := scanLogFile(path, rules, opts, host)
+		matches += n
+		if err != nil {
+			failed++
+			writeLog(logfile, fmt.Sprintf("Failed to scan %s: %v\n", path, err))
+			fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", path, err)
+		}
+	}
+	writeLog(logfile, fmt.Sprintf("Scanned %d files in %s, %d matches\n", len(files), dir, matches))
+	if failed > 0 {
+		return fmt.Errorf("%d files or directories under %s could not be scanned", failed, dir)
+	}
+	return nil
+}
+
+// scanLogFile prints the matches of the file at path and returns how many
+// there were.
+func scanLogFile(path string, rules *ruleSet, opts monitorOptions, host string) (int, error) {
+	r, err := openLogFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	grouper := newEventGrouper(opts.recordStartRe, opts.maxEventLines)
+	var context *contextCollector
+	if opts.before > 0 || opts.after > 0 {
+		context = newContextCollector(opts.before, opts.after)
+	}
+	matches := 0
+	report := func(match *logMatch) {
+		if match == nil {
+			return
+		}
+		matches++
+		fmt.Print(formatMatch(opts.format, host, path, match))
+	}
+	handle := func(event *logEvent) {
+		if event == nil {
+			return
+		}
+		rule := rules.matchEvent(path, event)
+		if context != nil {
+			report(context.add(event, rule))
+		} else if rule != nil {
+			report(&logMatch{rule: rule, event: event})
+		}
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	var offset int64
+	number := 1
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			text := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			handle(grouper.add(tailLine{text: text, offset: offset, number: number}))
+			offset += int64(len(line))
+			number++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return matches, err
+		}
+	}
+	handle(grouper.flush())
+	if context != nil {
+		report(context.flush())
+	}
+	return matches, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func gzipData(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestOpenLogFile(t *testing.T) {
+	const content = "first line\nsecond line\n"
+	compressed := gzipData(t, content)
+	tests := []struct {
+		name       string
+		file       string
+		data       []byte
+		want       string
+		compressed bool
+		wantErr    bool
+	}{
+		{name: "plain", file: "app.log", data: []byte(content), want: content},
+		{name: "gzip", file: "app.log.1.gz", data: compressed, want: content, compressed: true},
+		{name: "gzip without extension", file: "app.log.2", data: compressed, want: content, compressed: true},
+		{name: "empty", file: "empty.log", data: nil, want: ""},
+		{name: "corrupt gzip", file: "bad.log.gz", data: []byte{0x1f, 0x8b, 0, 1, 2}, compressed: true, wantErr: true},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := isCompressedLog(path); got != tt.compressed {
+				t.Errorf("isCompressedLog = %v, want %v", got, tt.compressed)
+			}
+			r, err := openLogFile(path)
+			if tt.wantErr {
+				if err == nil {
+					r.Close()
+					t.Fatal("openLogFile succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimArchiveSuffix(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"app.log", "app.log"},
+		{"app.log.gz", "app.log"},
+		{"app.log.1", "app.log"},
+		{"app.log.1.gz", "app.log"},
+		{"app.log-20240501", "app.log"},
+		{"app.log-20240501.gz", "app.log"},
+		{"app.log.2024-05-01", "app.log"},
+		{"app.log.2024-05-01-13", "app.log"},
+		{"logs/app.log.3.gz", "logs/app.log"},
+		{"server.out", "server.out"},
+	}
+	for _, tt := range tests {
+		if got := trimArchiveSuffix(tt.name); got != tt.want {
+			t.Errorf("trimArchiveSuffix(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRuleAppliesToRotations(t *testing.T) {
+	rs := testRules(t, &matchRule{Name: "app", Severity: "error", Include: []string{`ERROR`}, Files: []string{"app.log"}})
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"logs/app.log", true},
+		{"logs/app.log.1", true},
+		{"logs/app.log.1.gz", true},
+		{"logs/app.log-20240501.gz", true},
+		{"logs/other.log.1.gz", false},
+	}
+	for _, tt := range tests {
+		if got := rs.Rules[0].appliesTo(tt.path); got != tt.want {
+			t.Errorf("appliesTo(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFindLogFilesReadsCompressedLogs(t *testing.T) {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	files := map[string][]byte{
+		"logs/trace.4321.log":      []byte("named after the pid\n"),
+		"logs/app.log":             []byte("mentions 4321 but is not named after it\n"),
+		"logs/app.log.1.gz":        gzipData(t, "core dumped by process 4321\n"),
+		"logs/app_4321.log.2.gz":   gzipData(t, "rotated log of the pid\n"),
+		"logs/old/server.log.4321": []byte("suffixed with the pid\n"),
+		"logs/app.log.19.gz":       gzipData(t, "rotation 19\n"),
+	}
+	for name, data := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := findLogFiles("4321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"logs/app_4321.log.2.gz", "logs/old/server.log.4321", "logs/trace.4321.log"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("findLogFiles = %v, want %v", got, want)
+	}
+
+	// Rotation counters are not taken for the pid.
+	got, err = findLogFiles("9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = nil
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("findLogFiles = %v, want %v", got, want)
+	}
+}
+
+func TestScanLogsSkipsUnreadableDirectories(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced for root")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte("ERROR first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	locked := filepath.Join(dir, "locked")
+	if err := os.Mkdir(locked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(locked, "hidden.log"), []byte("ERROR hidden\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+	later := filepath.Join(dir, "zz")
+	if err := os.Mkdir(later, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(later, "later.log"), []byte("ERROR later\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := parseScanOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = scanLogs(dir, opts)
+	if err == nil || !strings.Contains(err.Error(), "1 files or directories") {
+		t.Fatalf("scanLogs error = %v, want 1 unreadable entry", err)
+	}
+	log, err := os.ReadFile(logfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "Scanned 2 files in "+dir) {
+		t.Errorf("log does not report the 2 readable files:\n%s", log)
+	}
+}
+
+func TestLogMonitorSkipsCompressedFilesOnce(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, gzipData(t, "ERROR compressed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := newTestMonitor(10)
+	for i := 0; i < 3; i++ {
+		if m.add(path, startSeen) {
+			t.Fatalf("add %d monitored the compressed file", i+1)
+		}
+	}
+	if !m.skipped[path] || len(m.files) != 0 {
+		t.Fatalf("skipped = %v, files = %d", m.skipped, len(m.files))
+	}
+	log, err := os.ReadFile(logfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(log), "Not monitoring compressed file "+path); n != 1 {
+		t.Errorf("compressed file reported %d times, want 1", n)
+	}
+
+	// A plain file written at the same path once the rotation removed the
+	// compressed one is monitored.
+	m.handle(fsnotify.Event{Name: path, Op: fsnotify.Remove})
+	if err := os.WriteFile(path, []byte("plain\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !m.add(path, startSeen) {
+		t.Fatal("the plain file replacing the compressed one was not monitored")
+	}
+	m.files[path].tail.close()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var assertionPattern = regexp.MustCompile(`^\s*([a-z0-9_]+)\s*(<=|>=|<|>)\s*(\S+)\s*$`)
+
+// assertion is an SLA threshold on a statistic of a series, such as
+// "p95<30s", "error_rate<1%" or "max<=120".
+type assertion struct {
+	expr      string
+	metric    string
+	op        string
+	threshold float64
+}
+
+// parseAssertion parses an assertion. Thresholds of time metrics are seconds
+// or Go durations, the threshold of error_rate is a percentage.
+func parseAssertion(expr string) (assertion, error) {
+	m := assertionPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return assertion{}, fmt.Errorf("invalid assertion %q, expected <metric><op><threshold>", expr)
+	}
+	a := assertion{expr: strings.TrimSpace(expr), metric: m[1], op: m[2]}
+
+	var err error
+	switch a.metric {
+	case "min", "max", "mean", "stddev", "p50", "p90", "p95", "p99":
+		a.threshold, err = parseSeconds(m[3])
+	case "error_rate":
+		a.threshold, err = strconv.ParseFloat(strings.TrimSuffix(m[3], "%"), 64)
+	default:
+		return a, fmt.Errorf("unknown metric %q in assertion %q", a.metric, expr)
+	}
+	if err != nil {
+		return a, fmt.Errorf("invalid threshold in assertion %q: %v", expr, err)
+	}
+	return a, nil
+}
+
+// parseSeconds parses a number of seconds or a Go duration into seconds.
+func parseSeconds(s string) (float64, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return d.Seconds(), nil
+}
+
+// value returns the statistic of stats checked by the assertion.
+func (a assertion) value(stats seriesStats) float64 {
+	switch a.metric {
+	case "min":
+		return stats.Min
+	case "max":
+		return stats.Max
+	case "mean":
+		return stats.Mean
+	case "stddev":
+		return stats.StdDev
+	case "p50":
+		return stats.P50
+	case "p90":
+		return stats.P90
+	case "p95":
+		return stats.P95
+	case "p99":
+		return stats.P99
+	case "error_rate":
+		runs := stats.Count + stats.Failed + stats.TimedOut
+		if runs == 0 {
+			return 0
+		}
+		return float64(stats.Failed+stats.TimedOut) * 100 / float64(runs)
+	}
+	return 0
+}
+
+func (a assertion) holds(value float64) bool {
+	switch a.op {
+	case "<":
+		return value < a.threshold
+	case "<=":
+		return value <= a.threshold
+	case ">":
+		return value > a.threshold
+	case ">=":
+		return value >= a.threshold
+	}
+	return false
+}
+
+// evaluateAssertions checks assertions against stats and returns the
+// pass/fail table and the number of failed assertions. An assertion on the
+// durations fails when no run succeeded.
+func evaluateAssertions(assertions []assertion, stats seriesStats) (string, int) {
+	var b strings.Builder
+	failed := 0
+	fmt.Fprintf(&b, "Assertions for %s:\n", stats.Script)
+	fmt.Fprintf(&b, "  %-24s %14s  %s\n", "ASSERTION", "ACTUAL", "RESULT")
+	for _, a := range assertions {
+		value := a.value(stats)
+		actual := fmt.Sprintf("%.3fs", value)
+		if a.metric == "error_rate" {
+			actual = fmt.Sprintf("%.2f%%", value)
+		}
+
+		result := "PASS"
+		if !a.holds(value) || (a.metric != "error_rate" && stats.Count == 0) {
+			result = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(&b, "  %-24s %14s  %s\n", a.expr, actual, result)
+	}
+	return b.String(), failed
+}
+
+// checkAssertions logs and prints the assertion table of stats and returns
+// an error when an assertion failed. Without assertions, it returns an
+// error when a run failed or timed out.
+func checkAssertions(assertions []assertion, stats seriesStats) error {
+	if len(assertions) == 0 {
+		if failed := stats.Failed + stats.TimedOut; failed > 0 {
+			return fmt.Errorf("%d of %d runs failed or timed out", failed, stats.Count+failed)
+		}
+		return nil
+	}
+	table, failed := evaluateAssertions(assertions, stats)
+	writeLog(logfile, table)
+	fmt.Print(table)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d assertions failed", failed, len(assertions))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    assertion
+		wantErr bool
+	}{
+		{"p95<30s", assertion{expr: "p95<30s", metric: "p95", op: "<", threshold: 30}, false},
+		{" max <= 120 ", assertion{expr: "max <= 120", metric: "max", op: "<=", threshold: 120}, false},
+		{"mean>=1.5", assertion{expr: "mean>=1.5", metric: "mean", op: ">=", threshold: 1.5}, false},
+		{"p50>250ms", assertion{expr: "p50>250ms", metric: "p50", op: ">", threshold: 0.25}, false},
+		{"error_rate<1%", assertion{expr: "error_rate<1%", metric: "error_rate", op: "<", threshold: 1}, false},
+		{"error_rate<=0.5", assertion{expr: "error_rate<=0.5", metric: "error_rate", op: "<=", threshold: 0.5}, false},
+		{"p95=30s", assertion{}, true},
+		{"p95<", assertion{}, true},
+		{"p42<1s", assertion{}, true},
+		{"p95<soon", assertion{}, true},
+		{"error_rate<few%", assertion{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAssertion(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAssertion(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseAssertion(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateAssertions(t *testing.T) {
+	stats := seriesStats{Script: "run.sh", Count: 8, Failed: 1, TimedOut: 1, Min: 1, Max: 10, Mean: 4, P95: 9}
+	tests := []struct {
+		name   string
+		exprs  []string
+		stats  seriesStats
+		failed int
+		lines  []string
+	}{
+		{"all pass", []string{"p95<10s", "max<=10", "error_rate<25%"}, stats, 0,
+			[]string{"p95<10s", "9.000s", "PASS", "error_rate<25%", "20.00%"}},
+		{"some fail", []string{"p95<9s", "mean>5", "min>=1", "error_rate<=20"}, stats, 2,
+			[]string{"p95<9s", "FAIL", "min>=1", "PASS", "error_rate<=20"}},
+		{"no successful run", []string{"max<10s", "error_rate<=100"}, seriesStats{Script: "run.sh", Failed: 3}, 1,
+			[]string{"max<10s", "FAIL", "100.00%", "PASS"}},
+		{"no run", []string{"error_rate<1%"}, seriesStats{Script: "run.sh"}, 0,
+			[]string{"0.00%", "PASS"}},
+	}
+	for _, tt := range tests {
+		var assertions []assertion
+		for _, expr := range tt.exprs {
+			a, err := parseAssertion(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertions = append(assertions, a)
+		}
+		table, failed := evaluateAssertions(assertions, tt.stats)
+		if failed != tt.failed {
+			t.Errorf("%s: %d assertions failed, want %d:\n%s", tt.name, failed, tt.failed, table)
+		}
+		// The expected fragments appear in order in the table.
+		rest := table
+		for _, line := range tt.lines {
+			i := strings.Index(rest, line)
+			if i < 0 {
+				t.Errorf("%s: %q missing or out of order in:\n%s", tt.name, line, table)
+				break
+			}
+			rest = rest[i+len(line):]
+		}
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	passed := seriesStats{Script: "run.sh", Count: 10, P95: 2}
+	failed := seriesStats{Script: "bad.sh", Count: 7, Failed: 2, TimedOut: 1, P95: 2}
+	timedOut := seriesStats{Script: "slow.sh", TimedOut: 3}
+	p95, err := parseAssertion("p95<5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		assertions []assertion
+		stats      seriesStats
+		wantErr    string
+	}{
+		{"no assertion, all passed", nil, passed, ""},
+		{"no assertion, failed runs", nil, failed, "3 of 10 runs failed or timed out"},
+		{"no assertion, timed out runs", nil, timedOut, "3 of 3 runs failed or timed out"},
+		{"assertions decide", []assertion{p95}, failed, ""},
+	}
+	for _, tt := range tests {
+		err := checkAssertions(tt.assertions, tt.stats)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("%s: checkAssertions() = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
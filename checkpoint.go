@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// checkpointHashBytes is how many bytes before the offset of a checkpoint
+// are hashed to recognise the file on restart.
+const checkpointHashBytes = 1024
+
+// fileCheckpoint records how far monitorLogs read a file. The inode and the
+// hash of the bytes just before the offset tell whether the file at the
+// path is still the one that was read. Line is the number of the line at
+// the offset, 0 when it was not known.
+type fileCheckpoint struct {
+	Inode  uint64 `json:"inode"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+	Line   int    `json:"line,omitempty"`
+	Hash   string `json:"hash"`
+}
+
+// monitorState holds the checkpoints of the monitored files by path.
+type monitorState struct {
+	Files map[string]fileCheckpoint `json:"files"`
+
+	path string
+}
+
+// loadMonitorState reads the checkpoints saved by a previous monitorLogs,
+// if any.
+func loadMonitorState(path string) (*monitorState, error) {
+	state := &monitorState{Files: make(map[string]fileCheckpoint), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]fileCheckpoint)
+	}
+	return state, nil
+}
+
+// save writes files, dropping the checkpoints of the files that no longer
+// exist. The file is replaced atomically so that a crash never leaves a
+// truncated state behind.
+func (state *monitorState) save(files map[string]fileCheckpoint) error {
+	saved := monitorState{Files: make(map[string]fileCheckpoint, len(files))}
+	for path, cp := range files {
+		if _, err := os.Stat(path); err == nil {
+			saved.Files[path] = cp
+		}
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := state.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, state.path)
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+// hashBefore hashes the checkpointHashBytes bytes of file before offset.
+func hashBefore(file *os.File, offset int64) (string, error) {
+	start := offset - checkpointHashBytes
+	if start < 0 {
+		start = 0
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, start, offset-start)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkpoint records the position of the tail, at the end of the last
+// complete line read.
+func (t *fileTail) checkpoint() (fileCheckpoint, error) {
+	info, err := t.file.Stat()
+	if err != nil {
+		return fileCheckpoint{}, err
+	}
+	offset := t.offset - int64(len(t.partial))
+	hash, err := hashBefore(t.file, offset)
+	if err != nil {
+		return fileCheckpoint{}, err
+	}
+	return fileCheckpoint{Inode: inodeOf(info), Size: info.Size(), Offset: offset, Line: t.lineNumber, Hash: hash}, nil
+}
+
+// resumeOffset returns the offset to resume reading path at from cp. It
+// reports false when the file was replaced or truncated since cp was
+// taken, in which case it is read again from the start.
+func resumeOffset(path string, cp fileCheckpoint) (int64, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	if inodeOf(info) != cp.Inode || info.Size() < cp.Offset {
+		return 0, false, nil
+	}
+	hash, err := hashBefore(file, cp.Offset)
+	if err != nil {
+		return 0, false, err
+	}
+	if hash != cp.Hash {
+		return 0, false, nil
+	}
+	return cp.Offset, true, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLines writes n numbered lines to a new file at path, followed by
+// partial without a newline.
+func writeLines(t *testing.T, path string, n int, partial string) {
+	t.Helper()
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	b.WriteString(partial)
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, path string)
+		offset int64
+		same   bool
+	}{
+		{"unchanged", func(*testing.T, string) {}, 12, true},
+		{"appended", func(t *testing.T, path string) { appendFile(t, path, "line 3\n") }, 12, true},
+		{"replaced", func(t *testing.T, path string) {
+			// The new file exists before the old one goes, so it has
+			// another inode even on file systems reusing them.
+			writeLines(t, path+".new", 2, "")
+			if err := os.Rename(path+".new", path); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, false},
+		{"truncated", func(t *testing.T, path string) {
+			if err := os.Truncate(path, 3); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, false},
+		{"rewritten in place", func(t *testing.T, path string) {
+			if err := os.WriteFile(path, []byte("LINE 1\nLINE 2\nmore\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "app.log")
+		writeLines(t, path, 2, "part")
+		tail, err := openFileTail(path, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tail.readLines(); err != nil {
+			t.Fatal(err)
+		}
+		cp, err := tail.checkpoint()
+		tail.close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cp.Offset != 14 {
+			t.Fatalf("checkpoint offset = %d, want the end of the last complete line", cp.Offset)
+		}
+
+		tt.change(t, path)
+		offset, same, err := resumeOffset(path, cp)
+		if err != nil || same != tt.same || same && offset != cp.Offset || !same && offset != 0 {
+			t.Errorf("%s: resumeOffset() = %d, %v, %v, want same %v", tt.name, offset, same, err, tt.same)
+		}
+	}
+
+	if _, _, err := resumeOffset(filepath.Join(t.TempDir(), "missing.log"), fileCheckpoint{}); err == nil {
+		t.Error("resumeOffset() of a missing file succeeded")
+	}
+}
+
+func TestMonitorStateSave(t *testing.T) {
+	dir := t.TempDir()
+	kept, gone := filepath.Join(dir, "kept.log"), filepath.Join(dir, "gone.log")
+	writeLines(t, kept, 1, "")
+	state, err := loadMonitorState(filepath.Join(dir, "state.json"))
+	if err != nil || len(state.Files) != 0 {
+		t.Fatalf("loadMonitorState() of a missing file = %v, %v", state, err)
+	}
+	if err := state.save(map[string]fileCheckpoint{kept: {Offset: 7}, gone: {Offset: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadMonitorState(state.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Files) != 1 || loaded.Files[kept].Offset != 7 {
+		t.Errorf("loaded checkpoints = %v, want only %s", loaded.Files, kept)
+	}
+}
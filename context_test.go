@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// collectContext feeds single-line events to a collector, the lines starting
+// with "ERROR" matching, and renders the matches it returns as
+// "first-last:match lines" strings, such as "3-7:5".
+func collectContext(before, after int, lines []string) []string {
+	rule := &matchRule{Name: "error", Severity: "error"}
+	c := newContextCollector(before, after)
+	var got []string
+	report := func(match *logMatch) {
+		if match == nil {
+			return
+		}
+		var matching []string
+		for _, line := range match.context {
+			if line.Match {
+				matching = append(matching, fmt.Sprint(line.Line))
+			}
+		}
+		first, last := match.context[0].Line, match.context[len(match.context)-1].Line
+		got = append(got, fmt.Sprintf("%d-%d:%s", first, last, strings.Join(matching, ",")))
+	}
+	for i, text := range lines {
+		event := &logEvent{lines: []string{text}, number: i + 1}
+		if strings.HasPrefix(text, "ERROR") {
+			report(c.add(event, rule))
+		} else {
+			report(c.add(event, nil))
+		}
+	}
+	report(c.flush())
+	return got
+}
+
+func TestContextCollector(t *testing.T) {
+	lines := func(spec string) []string {
+		// "e" is a matching line, "." a line that does not match.
+		var result []string
+		for _, c := range spec {
+			if c == 'e' {
+				result = append(result, "ERROR")
+			} else {
+				result = append(result, "ok")
+			}
+		}
+		return result
+	}
+	tests := []struct {
+		name          string
+		before, after int
+		lines         string
+		want          []string
+	}{
+		{"single match", 2, 2, "....e....", []string{"3-7:5"}},
+		{"at the start and end", 1, 1, "e...e", []string{"1-2:1", "4-5:5"}},
+		{"sharing a context line", 2, 2, "e...e", []string{"1-5:1,5"}},
+		{"overlapping contexts merge", 2, 2, "..e..e..", []string{"1-8:3,6"}},
+		{"touching contexts merge", 1, 1, ".e..e.", []string{"1-6:2,5"}},
+		{"separate contexts", 1, 1, ".e...e.", []string{"1-3:2", "5-7:6"}},
+		{"consecutive matches", 1, 1, ".ee.", []string{"1-4:2,3"}},
+		{"before only", 2, 0, "...e...e", []string{"2-4:4", "6-8:8"}},
+		{"after only", 0, 2, "e....e", []string{"1-3:1", "6-6:6"}},
+		{"after cut by the end", 1, 3, ".e.", []string{"1-3:2"}},
+		{"no match", 2, 2, "....", nil},
+	}
+	for _, tt := range tests {
+		got := collectContext(tt.before, tt.after, lines(tt.lines))
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContextCollectorMultiLineEvents(t *testing.T) {
+	rule := &matchRule{Name: "error", Severity: "error"}
+	c := newContextCollector(1, 1)
+	if c.add(&logEvent{lines: []string{"ok", "  more"}, number: 1}, nil) != nil {
+		t.Fatal("non-matching event completed a match")
+	}
+	if c.add(&logEvent{lines: []string{"ERROR", "\tat a.b(C.java:1)"}, number: 3}, rule) != nil || !c.holding() {
+		t.Fatal("matching event not held for its after-context")
+	}
+	// The lines after the after-context exceed the before lines of a next
+	// match, which completes the match.
+	match := c.add(&logEvent{lines: []string{"ok 5", "ok 6", "ok 7"}, number: 5}, nil)
+	if match == nil || match.rule != rule || match.event.number != 3 {
+		t.Fatalf("add() = %v, want the match of line 3", match)
+	}
+	var got []string
+	for _, line := range match.context {
+		got = append(got, fmt.Sprintf("%d%v", line.Line, line.Match))
+	}
+	if want := "2false 3true 4true 5false"; strings.Join(got, " ") != want {
+		t.Errorf("context = %s, want %s", strings.Join(got, " "), want)
+	}
+	if c.holding() {
+		t.Error("collector still holding a completed match")
+	}
+	// Only the last line of the gap is kept as the before-context.
+	match = c.add(&logEvent{lines: []string{"ERROR"}, number: 8}, rule)
+	if match != nil || c.flush().context[0].Line != 7 {
+		t.Error("next match does not start with the last line of the gap")
+	}
+}
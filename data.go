@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+)
+
+// dataSource hands out the rows of a CSV file to the iterations of a series.
+// The first row of the file names the columns.
+type dataSource struct {
+	mu      sync.Mutex
+	header  []string
+	rows    [][]string
+	mode    string
+	bind    string
+	onEnd   string
+	workers int
+
+	// next counts the rows handed out in the sequential mode, and workerNext
+	// the passes over the rows of each worker in the unique mode. done holds
+	// the sequential positions above next already consumed by the completed
+	// runs of an interrupted series, which are skipped when it resumes.
+	next       int
+	workerNext map[int]int
+	done       map[int]bool
+}
+
+// dataRow is a row handed out to a run. seq is its position in the rows
+// handed out by the sequential mode, or the pass of its worker over the rows
+// in the unique mode; the series state records it once the run completed.
+type dataRow struct {
+	mode   string
+	index  int
+	seq    int
+	values []string
+}
+
+func validDataMode(mode string) bool {
+	return mode == "sequential" || mode == "random" || mode == "unique"
+}
+
+func loadDataSource(path string, opts executeOptions) (*dataSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s has no data rows", path)
+	}
+	if opts.dataMode == "unique" && len(records)-1 < opts.workers {
+		return nil, fmt.Errorf("%s has %d rows, fewer than the %d workers", path, len(records)-1, opts.workers)
+	}
+	return &dataSource{
+		header:     records[0],
+		rows:       records[1:],
+		mode:       opts.dataMode,
+		bind:       opts.dataBind,
+		onEnd:      opts.onDataEnd,
+		workers:    opts.workers,
+		workerNext: make(map[int]int),
+	}, nil
+}
+
+// row returns the row for the next iteration of worker, or false when the
+// data is exhausted and must not be recycled. In the unique mode, worker w
+// only ever gets rows w, w+workers, w+2*workers and so on.
+func (d *dataSource) row(worker int, r *rand.Rand) (dataRow, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	row := dataRow{mode: d.mode}
+	switch d.mode {
+	case "random":
+		row.index = r.Intn(len(d.rows))
+	case "unique":
+		row.seq = d.workerNext[worker]
+		row.index = worker - 1 + row.seq*d.workers
+		if row.index >= len(d.rows) {
+			if d.onEnd != "recycle" {
+				return row, false
+			}
+			row.seq, row.index = 0, worker-1
+		}
+		d.workerNext[worker] = row.seq + 1
+	default:
+		for d.done[d.next] {
+			delete(d.done, d.next)
+			d.next++
+		}
+		if d.next >= len(d.rows) && d.onEnd != "recycle" {
+			return row, false
+		}
+		row.seq = d.next
+		row.index = d.next % len(d.rows)
+		d.next++
+	}
+	row.values = d.rows[row.index]
+	return row, true
+}
+
+// bindRow returns a copy of spec receiving values either as environment
+// variables named after the columns or as extra positional arguments.
+func (d *dataSource) bindRow(spec *scriptSpec, values []string) *scriptSpec {
+	bound := *spec
+	if d.bind == "args" {
+		bound.Args = append(append([]string(nil), spec.Args...), values...)
+		return &bound
+	}
+
+	bound.Env = make(map[string]string, len(spec.Env)+len(d.header))
+	for key, value := range spec.Env {
+		bound.Env[key] = value
+	}
+	for i, name := range d.header {
+		if i < len(values) {
+			bound.Env[name] = values[i]
+		}
+	}
+	return &bound
+}
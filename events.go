@@ -0,0 +1,177 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// continuationLine matches the lines that continue a Java stack trace when
+// no start-of-record pattern is configured: indented "at ..." frames,
+// "Caused by:" and "Suppressed:" chains and "... N more" markers.
+var continuationLine = regexp.MustCompile(`^(\s+\S|Caused by:|Suppressed:|\.\.\. \d+ more)`)
+
+// logEvent is a log record: its first line, which summarizes it, and its
+// continuation lines. offset and number locate the first line in the file.
+type logEvent struct {
+	lines  []string
+	offset int64
+	number int
+}
+
+func (e *logEvent) summary() string {
+	return e.lines[0]
+}
+
+// eventGrouper assembles the lines of a file into events. With recordStart,
+// every line not matching it continues the current event; otherwise the
+// continuation lines are recognised by continuationLine.
+type eventGrouper struct {
+	recordStart *regexp.Regexp
+	maxLines    int
+	pending     *logEvent
+}
+
+func newEventGrouper(recordStart *regexp.Regexp, maxLines int) *eventGrouper {
+	return &eventGrouper{recordStart: recordStart, maxLines: maxLines}
+}
+
+// add appends line and returns the event it completed, if any.
+func (g *eventGrouper) add(line tailLine) *logEvent {
+	if g.pending != nil && g.continues(line.text) {
+		if g.maxLines <= 0 || len(g.pending.lines) < g.maxLines {
+			g.pending.lines = append(g.pending.lines, line.text)
+		}
+		return nil
+	}
+	completed := g.pending
+	g.pending = &logEvent{lines: []string{line.text}, offset: line.offset, number: line.number}
+	return completed
+}
+
+// flush returns the pending event, which is complete when no line arrived
+// for a while.
+func (g *eventGrouper) flush() *logEvent {
+	completed := g.pending
+	g.pending = nil
+	return completed
+}
+
+func (g *eventGrouper) continues(line string) bool {
+	if g.recordStart != nil {
+		return !g.recordStart.MatchString(line)
+	}
+	return strings.TrimSpace(line) != "" && continuationLine.MatchString(line)
+}
+
+// matchEvent returns the first rule matching a line of the event, checking
+// the lines in order.
+func (rs *ruleSet) matchEvent(path string, event *logEvent) *matchRule {
+	for _, line := range event.lines {
+		if rule := rs.match(path, line); rule != nil {
+			return rule
+		}
+	}
+	return nil
+}
+
+// contextLine is a line reported around a match, match telling whether it
+// belongs to a matching event.
+type contextLine struct {
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
+
+// logMatch is a matching event to report, with its context lines when
+// -before or -after is set. The rule and event are those of the first
+// match of merged contexts.
+type logMatch struct {
+	rule    *matchRule
+	event   *logEvent
+	context []contextLine
+}
+
+// contextCollector adds the lines before and after the matching events of
+// a file, like grep -B and -A. The after-context is collected from the
+// following events as they are written, and matches whose contexts touch
+// or overlap are merged into a single match.
+type contextCollector struct {
+	before, after int
+
+	// recent holds the last lines before any open match.
+	recent []contextLine
+	// open is the match being collected, remaining is how many after lines
+	// it still takes, and gap holds the lines read since then, which join
+	// the match when another match follows within before lines.
+	open      *logMatch
+	remaining int
+	gap       []contextLine
+}
+
+func newContextCollector(before, after int) *contextCollector {
+	return &contextCollector{before: before, after: after}
+}
+
+func eventLines(event *logEvent, match bool) []contextLine {
+	lines := make([]contextLine, len(event.lines))
+	for i, text := range event.lines {
+		lines[i] = contextLine{Line: event.number + i, Text: text, Match: match}
+	}
+	return lines
+}
+
+// add takes the next event of the file with its matching rule, nil when it
+// does not match, and returns the match it completed, if any.
+func (c *contextCollector) add(event *logEvent, rule *matchRule) *logMatch {
+	if rule != nil {
+		lines := eventLines(event, true)
+		if c.open != nil {
+			c.open.context = append(append(c.open.context, c.gap...), lines...)
+			c.gap = nil
+		} else {
+			c.open = &logMatch{rule: rule, event: event, context: append(c.recent, lines...)}
+			c.recent = nil
+		}
+		c.remaining = c.after
+		return nil
+	}
+
+	lines := eventLines(event, false)
+	if c.open == nil {
+		c.recent = lastLines(append(c.recent, lines...), c.before)
+		return nil
+	}
+	take := len(lines)
+	if take > c.remaining {
+		take = c.remaining
+	}
+	c.open.context = append(c.open.context, lines[:take]...)
+	c.remaining -= take
+	c.gap = append(c.gap, lines[take:]...)
+	if len(c.gap) <= c.before {
+		return nil
+	}
+	return c.flush()
+}
+
+// flush returns the open match once no further line is expected for a
+// while, without waiting for the rest of its after-context.
+func (c *contextCollector) flush() *logMatch {
+	completed := c.open
+	c.open = nil
+	c.recent = lastLines(c.gap, c.before)
+	c.gap = nil
+	return completed
+}
+
+// holding reports whether a match waits for its after-context.
+func (c *contextCollector) holding() bool {
+	return c.open != nil
+}
+
+func lastLines(lines []contextLine, n int) []contextLine {
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return append([]contextLine(nil), lines...)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// groupEvents feeds the lines of text to a grouper and returns the lines of
+// the events it completed, flushing the last one.
+func groupEvents(g *eventGrouper, text string) [][]string {
+	var events [][]string
+	for i, line := range strings.Split(text, "\n") {
+		if event := g.add(tailLine{text: line, number: i + 1}); event != nil {
+			events = append(events, event.lines)
+		}
+	}
+	if event := g.flush(); event != nil {
+		events = append(events, event.lines)
+	}
+	return events
+}
+
+const javaTrace = `2024-05-01 12:00:00 ERROR Request failed
+java.lang.IllegalStateException: boom
+	at com.example.Service.handle(Service.java:42)
+	at com.example.Server.run(Server.java:10)
+Caused by: java.io.IOException: disk full
+	at java.io.FileOutputStream.write(Native Method)
+	... 2 more
+2024-05-01 12:00:01 INFO Next request`
+
+func TestEventGrouper(t *testing.T) {
+	tests := []struct {
+		name        string
+		recordStart string
+		maxLines    int
+		text        string
+		want        [][]string
+	}{
+		{"single lines", "", 0, "one\ntwo", [][]string{{"one"}, {"two"}}},
+		{"java stack trace", "", 0, javaTrace, [][]string{
+			strings.Split(javaTrace, "\n")[:1],
+			strings.Split(javaTrace, "\n")[1:7],
+			strings.Split(javaTrace, "\n")[7:],
+		}},
+		{"record start", `^\d{4}-\d{2}-\d{2} `, 0, javaTrace, [][]string{
+			strings.Split(javaTrace, "\n")[:7],
+			strings.Split(javaTrace, "\n")[7:],
+		}},
+		{"suppressed", "", 0, "Exception in thread main\n\tat a.b(C.java:1)\nSuppressed: x.Y: z\n\t\tat d.e(F.java:2)\nnext", [][]string{
+			{"Exception in thread main", "\tat a.b(C.java:1)", "Suppressed: x.Y: z", "\t\tat d.e(F.java:2)"},
+			{"next"},
+		}},
+		{"blank line ends the trace", "", 0, "Error\n\tat a.b(C.java:1)\n\n\tat c.d(E.java:2)", [][]string{
+			{"Error", "\tat a.b(C.java:1)"},
+			{"", "\tat c.d(E.java:2)"},
+		}},
+		{"max lines", "", 3, javaTrace, [][]string{
+			strings.Split(javaTrace, "\n")[:1],
+			strings.Split(javaTrace, "\n")[1:4],
+			strings.Split(javaTrace, "\n")[7:],
+		}},
+	}
+	for _, tt := range tests {
+		var recordStart *regexp.Regexp
+		if tt.recordStart != "" {
+			recordStart = regexp.MustCompile(tt.recordStart)
+		}
+		got := groupEvents(newEventGrouper(recordStart, tt.maxLines), tt.text)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEventGrouperLocatesEvents(t *testing.T) {
+	g := newEventGrouper(nil, 0)
+	g.add(tailLine{text: "first", offset: 0, number: 1})
+	g.add(tailLine{text: "java.lang.Error", offset: 6, number: 2})
+	event := g.add(tailLine{text: "\tat a.b(C.java:1)", offset: 22, number: 3})
+	if event != nil {
+		t.Fatalf("continuation line completed %v", event.lines)
+	}
+	event = g.flush()
+	if event == nil || event.offset != 6 || event.number != 2 || event.summary() != "java.lang.Error" {
+		t.Errorf("flush() = %+v, want the event starting at offset 6, line 2", event)
+	}
+	if g.flush() != nil {
+		t.Error("second flush() returned an event")
+	}
+}
+
+func TestMatchEvent(t *testing.T) {
+	rs := testRules(t,
+		&matchRule{Name: "io", Severity: "error", Include: []string{"IOException"}},
+		&matchRule{Name: "failed", Severity: "warning", Include: []string{"failed"}},
+	)
+	event := &logEvent{lines: strings.Split(javaTrace, "\n")[:7]}
+	if rule := rs.matchEvent("app.log", event); rule == nil || rule.Name != "failed" {
+		t.Errorf("matchEvent() = %v, want the rule of the first matching line", rule)
+	}
+	event = &logEvent{lines: strings.Split(javaTrace, "\n")[1:7]}
+	if rule := rs.matchEvent("app.log", event); rule == nil || rule.Name != "io" {
+		t.Errorf("matchEvent() = %v, want the rule matching a continuation line", rule)
+	}
+}
@@ -0,0 +1,686 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// outputTailLines is the number of output lines copied into pac_weiyu.log
+// when a run fails.
+const outputTailLines = 10
+
+// maxBackoff caps the delay between two attempts of a run.
+const maxBackoff = 10 * time.Minute
+
+// executeOptions holds the optional settings of executeAndTime.
+type executeOptions struct {
+	workers    int
+	timeout    time.Duration
+	onTimeout  string
+	onFailure  string
+	retries    int
+	backoff    time.Duration
+	outputDir  string
+	duration   time.Duration
+	stages     []stage
+	think      *thinkTime
+	dataFile   string
+	dataMode   string
+	dataBind   string
+	onDataEnd  string
+	assertions []assertion
+	labels     map[string]string
+	resultsDir string
+
+	// outputName replaces the script name in the names of the output
+	// files, runWorkflow setting it to the name of the step.
+	outputName string
+
+	// sampleInterval is the period of the resource sampling of the runs.
+	sampleInterval time.Duration
+
+	// otel publishes the run metrics through OpenTelemetry into metrics.
+	otel    bool
+	metrics *executionMetrics
+
+	// grace is how long an interrupted series waits for its running runs
+	// before killing them; abort is closed when that time is up.
+	grace     time.Duration
+	abort     <-chan struct{}
+	resume    bool
+	stateFile string
+
+	// maxInFlight caps the concurrent runs of executeAtRate.
+	maxInFlight int
+}
+
+// runResult records the outcome of a single run of a script.
+type runResult struct {
+	script   string
+	worker   int
+	run      int
+	start    time.Time
+	end      time.Time
+	err      error
+	timedOut bool
+	exitCode int
+	attempt  int
+	usage    resourceUsage
+
+	// interrupted is set when the run was killed at the end of the grace
+	// period of an interrupted series.
+	interrupted bool
+}
+
+func (r runResult) duration() time.Duration {
+	return r.end.Sub(r.start)
+}
+
+func parseExecuteOptions(args []string) (executeOptions, error) {
+	var opts executeOptions
+	fs := flag.NewFlagSet("executeAndTime", flag.ContinueOnError)
+	addRunFlags(fs, &opts)
+	fs.IntVar(&opts.workers, "workers", 1, "number of concurrent virtual users")
+	fs.DurationVar(&opts.duration, "duration", 0, "run for this wall-clock duration instead of a number of times")
+	stages := fs.String("stages", "", "ramp-up/ramp-down stages as <duration>:<workers>,...")
+	think := fs.String("think", "", "random think time added to the pacing: uniform:<min>-<max> or exponential:<mean>")
+	fs.StringVar(&opts.dataFile, "data", "", "CSV file whose rows are bound to the runs")
+	fs.StringVar(&opts.dataMode, "data-mode", "sequential", "how rows are picked: sequential, random or unique")
+	fs.StringVar(&opts.dataBind, "data-bind", "env", "how a row is passed to the script: env or args")
+	fs.StringVar(&opts.onDataEnd, "on-data-end", "stop", "what to do when the rows are exhausted: stop or recycle")
+	fs.DurationVar(&opts.grace, "grace", 30*time.Second, "how long an interrupted series waits for its running runs before killing them")
+	fs.BoolVar(&opts.resume, "resume", false, "resume the series interrupted by the previous invocation")
+	fs.StringVar(&opts.stateFile, "state", "", "file recording the progress of the series (default <script>.series_state.json)")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if !validDataMode(opts.dataMode) {
+		return opts, fmt.Errorf("invalid data mode: %s", opts.dataMode)
+	}
+	if opts.dataBind != "env" && opts.dataBind != "args" {
+		return opts, fmt.Errorf("invalid data binding: %s", opts.dataBind)
+	}
+	if opts.onDataEnd != "stop" && opts.onDataEnd != "recycle" {
+		return opts, fmt.Errorf("invalid end-of-data policy: %s", opts.onDataEnd)
+	}
+	if *stages != "" {
+		var err error
+		if opts.stages, err = parseStages(*stages); err != nil {
+			return opts, err
+		}
+		opts.workers = maxStageWorkers(opts.stages)
+	}
+	if *think != "" {
+		t, err := parseThinkTime(*think)
+		if err != nil {
+			return opts, err
+		}
+		opts.think = &t
+	}
+	if opts.duration < 0 {
+		return opts, fmt.Errorf("invalid duration: %v", opts.duration)
+	}
+	if opts.workers < 1 {
+		return opts, fmt.Errorf("invalid number of workers: %d", opts.workers)
+	}
+	return opts, validateRunOptions(opts)
+}
+
+// addRunFlags registers the flags controlling how each run is executed.
+func addRunFlags(fs *flag.FlagSet, opts *executeOptions) {
+	fs.DurationVar(&opts.timeout, "timeout", 0, "maximum duration of a run, 0 for no limit")
+	fs.StringVar(&opts.onTimeout, "on-timeout", "stop", "what to do after a run timed out: stop, continue or retry")
+	fs.StringVar(&opts.onFailure, "on-failure", "stop", "what to do after a run failed: stop, continue or retry")
+	fs.IntVar(&opts.retries, "retries", 3, "maximum number of retries of a run with the retry policy")
+	fs.DurationVar(&opts.backoff, "backoff", time.Second, "delay before the first retry, doubled for each further retry up to 10m")
+	fs.StringVar(&opts.outputDir, "output-dir", "runs", "directory receiving the stdout and stderr of each run")
+	fs.BoolVar(&opts.otel, "otel", false, "publish run durations, outcomes and runs in flight as OpenTelemetry metrics")
+	fs.DurationVar(&opts.sampleInterval, "sample-interval", 200*time.Millisecond, "period of the memory and I/O sampling of each run, 0 to rely on rusage only")
+	fs.Func("label", "key=value label stored with the series, may be repeated", func(label string) error {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid label %q, expected key=value", label)
+		}
+		if opts.labels == nil {
+			opts.labels = make(map[string]string)
+		}
+		opts.labels[key] = value
+		return nil
+	})
+	fs.StringVar(&opts.resultsDir, "results-dir", "results", "directory storing the result record of each series")
+	fs.Func("assert", "SLA assertion such as p95<30s or error_rate<1%, may be repeated", func(expr string) error {
+		a, err := parseAssertion(expr)
+		if err != nil {
+			return err
+		}
+		opts.assertions = append(opts.assertions, a)
+		return nil
+	})
+}
+
+func validateRunOptions(opts executeOptions) error {
+	if opts.timeout < 0 {
+		return fmt.Errorf("invalid timeout: %v", opts.timeout)
+	}
+	if !validPolicy(opts.onTimeout) {
+		return fmt.Errorf("invalid timeout policy: %s", opts.onTimeout)
+	}
+	if !validPolicy(opts.onFailure) {
+		return fmt.Errorf("invalid failure policy: %s", opts.onFailure)
+	}
+	if opts.retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", opts.retries)
+	}
+	if opts.backoff < 0 {
+		return fmt.Errorf("invalid backoff: %v", opts.backoff)
+	}
+	return nil
+}
+
+func validPolicy(policy string) bool {
+	return policy == "stop" || policy == "continue" || policy == "retry"
+}
+
+// series holds what the workers of an executeAndTime series share.
+type series struct {
+	scenario *scenario
+	times    int
+	pacing   time.Duration
+	start    time.Time
+	opts     executeOptions
+	data     *dataSource
+	state    *seriesState
+
+	// ctx is cancelled by SIGINT or SIGTERM.
+	ctx context.Context
+}
+
+// executeAndTime runs script in opts.workers concurrent workers, pausing
+// pacing between the runs of a worker. Each worker runs the script times
+// times, or until the duration or the stages of opts are over.
+func executeAndTime(script string, times int, pacing time.Duration, opts executeOptions) error {
+	return runSeries(singleScriptScenario(script), times, pacing, opts)
+}
+
+// executeScenario is executeAndTime for the weighted mix of scripts of a
+// scenario file: each iteration of a worker runs one of them.
+func executeScenario(scenarioFile string, times int, pacing time.Duration, opts executeOptions) error {
+	sc, err := loadScenario(scenarioFile)
+	if err != nil {
+		return fmt.Errorf("failed to load scenario: %v", err)
+	}
+	return runSeries(sc, times, pacing, opts)
+}
+
+// runSeries runs the workers of a series and returns an error when the
+// series could not start or one of the assertions of opts failed.
+func runSeries(sc *scenario, times int, pacing time.Duration, opts executeOptions) (err error) {
+	if opts.workers < 1 {
+		opts.workers = 1
+	}
+	if times <= 0 && opts.duration == 0 && len(opts.stages) == 0 {
+		return errors.New("times must be positive unless -duration or -stages is given")
+	}
+	if err := os.MkdirAll(opts.outputDir, 0755); err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to create %s: %v\n", opts.outputDir, err))
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	var data *dataSource
+	if opts.dataFile != "" {
+		if data, err = loadDataSource(opts.dataFile, opts); err != nil {
+			return fmt.Errorf("failed to load data file: %v", err)
+		}
+	}
+
+	otelShutdown, err := enableExecutionMetrics(&opts)
+	if err != nil {
+		return fmt.Errorf("failed to set up OpenTelemetry: %v", err)
+	}
+	defer func() {
+		err = errors.Join(err, otelShutdown(context.Background()))
+	}()
+
+	if opts.stateFile == "" {
+		opts.stateFile = defaultStateFile(sc)
+	}
+	start := time.Now()
+	state := newSeriesState(opts.stateFile, sc, times, opts)
+	if opts.resume {
+		if state, err = loadSeriesState(opts.stateFile, sc, times, opts); err != nil {
+			return err
+		}
+		if data != nil {
+			state.restoreData(data)
+		}
+		start = start.Add(-time.Duration(state.Elapsed * float64(time.Second)))
+		writeLog(logfile, fmt.Sprintf("Resuming series of %s from %s\n", sc.Name, opts.stateFile))
+	}
+
+	// Stop launching runs on SIGINT or SIGTERM, and kill the running ones
+	// if they do not finish within the grace period.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	abort := make(chan struct{})
+	opts.abort = abort
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-finished:
+			return
+		}
+		message := fmt.Sprintf("Series of %s interrupted, waiting up to %v seconds for the running runs\n", sc.Name, opts.grace.Seconds())
+		writeLog(logfile, message)
+		fmt.Print(message)
+		select {
+		case <-time.After(opts.grace):
+			writeLog(logfile, fmt.Sprintf("Grace period over, killing the running runs of %s\n", sc.Name))
+			close(abort)
+		case <-finished:
+		}
+	}()
+
+	s := &series{scenario: sc, times: times, pacing: pacing, start: start, opts: opts, data: data, state: state, ctx: ctx}
+	results := make([][]runResult, opts.workers)
+	var wg sync.WaitGroup
+	for w := 1; w <= opts.workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			results[worker-1] = s.runWorker(worker)
+		}(w)
+	}
+	wg.Wait()
+	close(finished)
+
+	interrupted := ctx.Err() != nil
+	stop()
+	if interrupted {
+		message := fmt.Sprintf("Series of %s interrupted, resume it with -resume (state saved in %s)\n", sc.Name, opts.stateFile)
+		writeLog(logfile, message)
+		fmt.Print(message)
+	} else {
+		state.remove()
+	}
+
+	stats := writeSeriesSummary(sc, opts, time.Since(s.start), results)
+	logStoredSeries(sc, opts, s.start, results)
+	return checkAssertions(opts.assertions, stats)
+}
+
+// deadline returns when the series ends because of -duration or -stages,
+// and false when it only ends after a number of runs.
+func (s *series) deadline() (time.Time, bool) {
+	length := s.opts.duration
+	if len(s.opts.stages) > 0 {
+		if total := stagesDuration(s.opts.stages); length == 0 || total < length {
+			length = total
+		}
+	}
+	if length == 0 {
+		return time.Time{}, false
+	}
+	return s.start.Add(length), true
+}
+
+// runWorker executes the run loop of one virtual user and returns its results.
+func (s *series) runWorker(worker int) []runResult {
+	var results []runResult
+	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(worker)))
+	for i := s.state.next(worker); (s.times <= 0 || i <= s.times) && s.ctx.Err() == nil; {
+		elapsed := time.Since(s.start)
+		if s.opts.duration > 0 && elapsed >= s.opts.duration {
+			break
+		}
+		if len(s.opts.stages) > 0 {
+			active, ok := stageWorkers(s.opts.stages, elapsed)
+			if !ok {
+				break
+			}
+			if worker > active {
+				s.sleep(stagePollInterval)
+				continue
+			}
+		}
+
+		spec := s.scenario.pick(r)
+		var row *dataRow
+		if s.data != nil {
+			next, ok := s.data.row(worker, r)
+			if !ok {
+				writeLog(logfile, fmt.Sprintf("No more data rows for %s %s\n", spec.Name, runLabel(worker, i, s.opts)))
+				break
+			}
+			row = &next
+			writeLog(logfile, fmt.Sprintf("Binding data row %d to %s %s\n", row.index+1, spec.Name, runLabel(worker, i, s.opts)))
+			spec = s.data.bindRow(spec, row.values)
+		}
+
+		result := executeRun(s.ctx, spec, worker, i, s.opts)
+		if result.interrupted {
+			// The run is not a sample of the series and is run again on resume.
+			break
+		}
+		results = append(results, result)
+		s.state.advance(worker, i, time.Since(s.start), row)
+		if result.err != nil && failurePolicy(result, s.opts) != "continue" {
+			break
+		}
+		i++
+
+		pause := s.pacing
+		if s.opts.think != nil {
+			pause += s.opts.think.sample(r)
+		}
+		s.sleep(pause)
+	}
+	return results
+}
+
+// sleep pauses a worker for d, or until the series is interrupted or over.
+func (s *series) sleep(d time.Duration) {
+	if end, ok := s.deadline(); ok {
+		if left := time.Until(end); left < d {
+			d = left
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-s.ctx.Done():
+	}
+}
+
+// executeRun performs one run of a worker, retrying it with an exponential
+// backoff while the failure policy asks for it. Once ctx is done, no further
+// attempt is started and the run is reported as interrupted, so that it is
+// run again on resume.
+func executeRun(ctx context.Context, spec *scriptSpec, worker int, run int, opts executeOptions) runResult {
+	for attempt := 1; ; attempt++ {
+		label := runLabel(worker, run, opts)
+		if attempt > 1 {
+			label += fmt.Sprintf(" attempt %d", attempt)
+		}
+		result := executeAttempt(spec, label, worker, run, attempt, opts)
+		retry := result.err != nil && !result.interrupted && failurePolicy(result, opts) == "retry" && attempt <= opts.retries
+		opts.metrics.runEnded(result, retry)
+		if !retry {
+			return result
+		}
+
+		backoff := retryBackoff(opts.backoff, attempt)
+		writeLog(logfile, fmt.Sprintf("Retrying %s %s in %v seconds\n", spec.Name, runLabel(worker, run, opts), backoff.Seconds()))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			writeLog(logfile, fmt.Sprintf("Not retrying %s %s: interrupted\n", spec.Name, runLabel(worker, run, opts)))
+			result.interrupted = true
+			return result
+		}
+	}
+}
+
+// retryBackoff returns the delay after the given failed attempt: initial,
+// doubled for each further attempt up to maxBackoff.
+func retryBackoff(initial time.Duration, attempt int) time.Duration {
+	backoff := initial
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// executeAttempt runs a script once, capturing its stdout and stderr in the
+// output directory and logging the outcome.
+func executeAttempt(spec *scriptSpec, label string, worker int, run int, attempt int, opts executeOptions) runResult {
+	script := spec.Name
+	result := runResult{script: script, worker: worker, run: run, attempt: attempt, exitCode: -1}
+
+	base := filepath.Join(opts.outputDir, outputFileBase(spec, worker, run, attempt, opts))
+	stdoutFile, stderrFile := base+".stdout", base+".stderr"
+	stdout, err := os.Create(stdoutFile)
+	if err != nil {
+		result.err = err
+		writeLog(logfile, fmt.Sprintf("Failed to create %s: %v\n", stdoutFile, err))
+		return result
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(stderrFile)
+	if err != nil {
+		result.err = err
+		writeLog(logfile, fmt.Sprintf("Failed to create %s: %v\n", stderrFile, err))
+		return result
+	}
+	defer stderr.Close()
+
+	result.start = time.Now()
+	message := fmt.Sprintf("Starting %s %s at %s\n", script, label, result.start)
+	writeLog(logfile, message)
+	opts.metrics.runStarted(script)
+	defer opts.metrics.runStopped(script)
+
+	result.usage, result.timedOut, result.interrupted, result.err = runScript(spec, opts.timeout, opts.sampleInterval, opts.abort, stdout, stderr)
+	result.end = time.Now()
+	var exitErr *exec.ExitError
+	if result.err == nil {
+		result.exitCode = 0
+	} else if errors.As(result.err, &exitErr) {
+		result.exitCode = exitErr.ExitCode()
+	}
+
+	switch {
+	case result.interrupted:
+		message = fmt.Sprintf("%s %s interrupted after %v seconds\n", script, label, result.duration().Seconds())
+	case result.timedOut:
+		message = fmt.Sprintf("%s %s timed out after %v seconds\n", script, label, opts.timeout.Seconds())
+	case result.exitCode > 0:
+		message = fmt.Sprintf("%s %s failed with exit status %d\n", script, label, result.exitCode)
+	case result.err != nil:
+		message = fmt.Sprintf("%s %s failed: %v\n", script, label, result.err)
+	default:
+		message = fmt.Sprintf("Execution time for %s %s: %v seconds\n", script, label, result.duration().Seconds())
+		writeLog(logfile, message)
+		writeLog(logfile, fmt.Sprintf("Resources for %s %s: %s\n", script, label, formatUsage(result.usage)))
+		message = fmt.Sprintf("Ended %s %s at %s\n", script, label, result.end)
+		writeLog(logfile, message)
+		return result
+	}
+	writeLog(logfile, message)
+	writeLog(logfile, fmt.Sprintf("Resources for %s %s: %s\n", script, label, formatUsage(result.usage)))
+	logOutputTail(stdoutFile)
+	logOutputTail(stderrFile)
+	return result
+}
+
+// failurePolicy returns the policy that applies to a failed run.
+func failurePolicy(result runResult, opts executeOptions) string {
+	if result.timedOut {
+		return opts.onTimeout
+	}
+	return opts.onFailure
+}
+
+// runScript runs a script in its own process group, writing its output to
+// stdout and stderr and sampling the resources of the group every
+// sampleInterval. When timeout is positive and the run exceeds it, or when
+// abort is closed, the whole process group is killed so that no
+// grandchildren of the script are left behind.
+func runScript(spec *scriptSpec, timeout time.Duration, sampleInterval time.Duration, abort <-chan struct{}, stdout, stderr io.Writer) (usage resourceUsage, timedOut bool, aborted bool, err error) {
+	cmd := spec.command()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return usage, false, false, err
+	}
+	sampler := startTreeSampler(cmd.Process.Pid, sampleInterval)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err = <-done:
+	case <-expired:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		timedOut = true
+		err = fmt.Errorf("timed out after %v", timeout)
+	case <-abort:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		aborted = true
+		err = errors.New("interrupted")
+	}
+	return sampler.finish(cmd), timedOut, aborted, err
+}
+
+// outputFileBase names the files holding the output of a run.
+func outputFileBase(spec *scriptSpec, worker int, run int, attempt int, opts executeOptions) string {
+	base := strings.TrimSuffix(filepath.Base(spec.Name), filepath.Ext(spec.Name))
+	if opts.outputName != "" {
+		base = opts.outputName
+	}
+	if spec.index > 0 {
+		base += fmt.Sprintf("_script%d", spec.index)
+	}
+	if opts.workers > 1 {
+		base += fmt.Sprintf("_worker%d", worker)
+	}
+	base += fmt.Sprintf("_run%d", run)
+	if attempt > 1 {
+		base += fmt.Sprintf("_attempt%d", attempt)
+	}
+	return base
+}
+
+// logOutputTail copies the last lines of a captured output file into
+// pac_weiyu.log.
+func logOutputTail(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to read %s: %v\n", path, err))
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return
+	}
+	if len(lines) > outputTailLines {
+		lines = lines[len(lines)-outputTailLines:]
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Last lines of %s:\n", path)
+	for _, line := range lines {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	writeLog(logfile, b.String())
+}
+
+// runLabel names a run in pac_weiyu.log. A single worker keeps the historical
+// "run N" form so existing log consumers keep working.
+func runLabel(worker, run int, opts executeOptions) string {
+	if opts.workers <= 1 {
+		return fmt.Sprintf("run %d", run)
+	}
+	return fmt.Sprintf("worker %d run %d", worker, run)
+}
+
+// writeSeriesSummary logs and prints the combined outcome of all workers,
+// followed by the statistical report of the series and, for a mix of
+// scripts, of each script.
+func writeSeriesSummary(sc *scenario, opts executeOptions, elapsed time.Duration, results [][]runResult) seriesStats {
+	var all []runResult
+	for _, workerResults := range results {
+		all = append(all, workerResults...)
+	}
+
+	stats := summarizeResults(sc.Name, all)
+	message := fmt.Sprintf("Summary for %s: %d workers, %d runs, %d succeeded, %d failed, %d timed out, mean execution time %v seconds, elapsed %v seconds\n",
+		sc.Name, opts.workers, len(all), stats.Count, stats.Failed, stats.TimedOut, stats.Mean, elapsed.Seconds())
+	writeLog(logfile, message)
+	fmt.Print(message)
+
+	report := formatStats(stats)
+	if len(sc.Scripts) > 1 {
+		for _, spec := range sc.Scripts {
+			var scriptResults []runResult
+			for _, r := range all {
+				if r.script == spec.Name {
+					scriptResults = append(scriptResults, r)
+				}
+			}
+			scriptStats := summarizeResults(spec.Name, scriptResults)
+			stats.Scripts = append(stats.Scripts, scriptStats)
+			report += formatStats(scriptStats)
+		}
+	}
+	writeLog(logfile, report)
+	fmt.Print(report)
+
+	jsonFile, csvFile, err := writeStatsFiles(stats, time.Now())
+	if err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to write summary files: %v\n", err))
+		return stats
+	}
+	writeLog(logfile, fmt.Sprintf("Summary written to %s and %s\n", jsonFile, csvFile))
+	return stats
+}
+
+// logStoredSeries stores the results of a series and logs where they went.
+func logStoredSeries(sc *scenario, opts executeOptions, start time.Time, results [][]runResult) {
+	id, err := storeSeries(sc, opts, start, results)
+	if err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to store the results of %s: %v\n", sc.Name, err))
+		return
+	}
+	message := fmt.Sprintf("Series %s stored as %s\n", id, filepath.Join(opts.resultsDir, id+".json"))
+	writeLog(logfile, message)
+	fmt.Print(message)
+}
+
+// summarizeResults computes the statistics of the successful runs among
+// results and counts the others.
+func summarizeResults(name string, results []runResult) seriesStats {
+	var failed, timedOut int
+	var durations []float64
+	for _, r := range results {
+		switch {
+		case r.timedOut:
+			timedOut++
+		case r.err != nil:
+			failed++
+		default:
+			durations = append(durations, r.duration().Seconds())
+		}
+	}
+	stats := computeStats(name, durations, failed, timedOut)
+	stats.Resources = computeResourceStats(results)
+	return stats
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeScript writes a bash script with the given body to dir.
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecuteAndTimeWorkers(t *testing.T) {
+	dir := t.TempDir()
+	script := writeScript(t, dir, "vu.sh", "sleep 0.5\necho done\n")
+	opts, err := parseExecuteOptions([]string{"-workers", "2",
+		"-output-dir", filepath.Join(dir, "runs"), "-results-dir", filepath.Join(dir, "results"), "-state", filepath.Join(dir, "state.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := executeAndTime(script, 2, 0, opts); err != nil {
+		t.Fatal(err)
+	}
+	// Two workers run the four runs of half a second in about a second.
+	if elapsed := time.Since(start); elapsed >= 1800*time.Millisecond {
+		t.Errorf("series took %v, the workers did not run concurrently", elapsed)
+	}
+
+	log, err := os.ReadFile(logfile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range []struct{ label, output string }{
+		{"worker 1 run 1", "vu_worker1_run1.stdout"},
+		{"worker 1 run 2", "vu_worker1_run2.stdout"},
+		{"worker 2 run 1", "vu_worker2_run1.stdout"},
+		{"worker 2 run 2", "vu_worker2_run2.stdout"},
+	} {
+		if !strings.Contains(string(log), "Starting "+script+" "+run.label+" at") {
+			t.Errorf("no start of %s logged", run.label)
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "runs", run.output)); err != nil || string(data) != "done\n" {
+			t.Errorf("%s = %q, %v, want the output of %s", run.output, data, err, run.label)
+		}
+	}
+	if strings.Contains(string(log), "Starting "+script+" worker 1 run 3") || strings.Contains(string(log), "Starting "+script+" worker 3") {
+		t.Error("more runs started than asked")
+	}
+	summary := "Summary for " + script + ": 2 workers, 4 runs, 4 succeeded, 0 failed, 0 timed out"
+	if !strings.Contains(string(log), summary) {
+		t.Errorf("log lacks %q", summary)
+	}
+}
+
+// processGone reports whether pid exited, a zombie left unreaped counting
+// as exited.
+func processGone(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return syscall.Kill(pid, 0) == syscall.ESRCH
+	}
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func TestExecuteAttemptTimeout(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "grandchild.pid")
+	script := writeScript(t, dir, "hang.sh", "sleep 60 &\necho $! > "+pidFile+"\nwait\n")
+	spec := &singleScriptScenario(script).Scripts[0]
+	opts := executeOptions{workers: 1, timeout: 300 * time.Millisecond, onTimeout: "stop", outputDir: dir}
+
+	start := time.Now()
+	result := executeAttempt(spec, "run 1", 0, 1, 1, opts)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("run took %v despite the timeout of %v", elapsed, opts.timeout)
+	}
+	if !result.timedOut || result.exitCode != -1 || result.err == nil {
+		t.Errorf("result = timed out %v, exit code %d, err %v, want a timeout with exit code -1", result.timedOut, result.exitCode, result.err)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !processGone(pid) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("grandchild %d still running after the timeout", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		initial time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{time.Second, 1, time.Second},
+		{time.Second, 2, 2 * time.Second},
+		{time.Second, 4, 8 * time.Second},
+		{time.Second, 10, 512 * time.Second},
+		{time.Second, 11, maxBackoff},
+		{time.Second, 1000, maxBackoff},
+		{time.Hour, 1, maxBackoff},
+		{0, 5, 0},
+	}
+	for _, tt := range tests {
+		if got := retryBackoff(tt.initial, tt.attempt); got != tt.want {
+			t.Errorf("retryBackoff(%v, %d) = %v, want %v", tt.initial, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRunOptions(t *testing.T) {
+	valid := executeOptions{onTimeout: "stop", onFailure: "continue", retries: 1, backoff: time.Second}
+	tests := []struct {
+		name    string
+		change  func(*executeOptions)
+		wantErr bool
+	}{
+		{"valid", func(*executeOptions) {}, false},
+		{"zero backoff", func(o *executeOptions) { o.backoff = 0 }, false},
+		{"negative backoff", func(o *executeOptions) { o.backoff = -time.Second }, true},
+		{"negative retries", func(o *executeOptions) { o.retries = -1 }, true},
+		{"negative timeout", func(o *executeOptions) { o.timeout = -time.Second }, true},
+		{"unknown policy", func(o *executeOptions) { o.onFailure = "ignore" }, true},
+	}
+	for _, tt := range tests {
+		opts := valid
+		tt.change(&opts)
+		if err := validateRunOptions(opts); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateRunOptions() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestExecuteRunBackoffInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	script := writeScript(t, dir, "bad.sh", "exit 3\n")
+	spec := &singleScriptScenario(script).Scripts[0]
+	opts := executeOptions{workers: 1, onFailure: "retry", onTimeout: "retry", retries: 5, backoff: time.Hour, outputDir: dir}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	result := executeRun(ctx, spec, 0, 1, opts)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("executeRun returned after %v, not when interrupted", elapsed)
+	}
+	if !result.interrupted || result.attempt != 1 || result.exitCode != 3 {
+		t.Errorf("result = interrupted %v, attempt %d, exit code %d, want interrupted after attempt 1 with exit code 3",
+			result.interrupted, result.attempt, result.exitCode)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad_run1_attempt2.stdout")); err == nil {
+		t.Error("a second attempt started after the interrupt")
+	}
+
+	// A context already done prevents any retry.
+	result = executeRun(ctx, spec, 0, 2, opts)
+	if !result.interrupted || result.attempt != 1 {
+		t.Errorf("run 2 = interrupted %v after attempt %d, want interrupted after attempt 1", result.interrupted, result.attempt)
+	}
+}
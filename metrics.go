@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// executionMetrics publishes the progress of a series through the meter
+// provider set up by setupOTelSDK. A nil *executionMetrics records nothing.
+type executionMetrics struct {
+	duration  metric.Float64Histogram
+	successes metric.Int64Counter
+	failures  metric.Int64Counter
+	inFlight  metric.Int64UpDownCounter
+}
+
+// enableExecutionMetrics sets up OpenTelemetry and serves the run metrics
+// when opts asks for them. The returned function shuts the SDK down.
+func enableExecutionMetrics(opts *executeOptions) (func(context.Context) error, error) {
+	if !opts.otel {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	serviceName := "PAC Metrics"
+	serviceVersion := "1.0"
+	otelShutdown, err := setupOTelSDK(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	opts.metrics, err = newExecutionMetrics(otel.Meter("Script Execution"))
+	if err != nil {
+		return nil, errors.Join(err, otelShutdown(context.Background()))
+	}
+
+	go serveMetrics()
+	return otelShutdown, nil
+}
+
+func newExecutionMetrics(meter metric.Meter) (*executionMetrics, error) {
+	var m executionMetrics
+	var err error
+	if m.duration, err = meter.Float64Histogram("ScriptRunDuration",
+		metric.WithDescription("Execution time of the successful runs of a script"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.1, 0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600, 1800),
+	); err != nil {
+		return nil, err
+	}
+	if m.successes, err = meter.Int64Counter("ScriptRunSuccesses",
+		metric.WithDescription("Number of successful runs of a script"),
+	); err != nil {
+		return nil, err
+	}
+	if m.failures, err = meter.Int64Counter("ScriptRunFailures",
+		metric.WithDescription("Number of failed, timed out or interrupted attempts of a script, by reason and whether they were retried"),
+	); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = meter.Int64UpDownCounter("ScriptRunsInFlight",
+		metric.WithDescription("Number of runs of a script currently executing"),
+	); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *executionMetrics) runStarted(script string) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(context.Background(), 1, metric.WithAttributes(attribute.String("script", script)))
+}
+
+func (m *executionMetrics) runStopped(script string) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(context.Background(), -1, metric.WithAttributes(attribute.String("script", script)))
+}
+
+// runEnded records the outcome of an attempt. The attempts that failed are
+// counted by reason, an interrupted attempt not being a failure of the
+// script, and with whether they were retried, so that the runs that failed
+// in the end are those not retried.
+func (m *executionMetrics) runEnded(result runResult, retried bool) {
+	if m == nil {
+		return
+	}
+	ctx := context.Background()
+	attrs := metric.WithAttributes(attribute.String("script", result.script))
+	if result.err != nil {
+		reason := "failed"
+		switch {
+		case result.interrupted:
+			reason = "interrupted"
+		case result.timedOut:
+			reason = "timed out"
+		}
+		m.failures.Add(ctx, 1, metric.WithAttributes(attribute.String("script", result.script),
+			attribute.String("reason", reason), attribute.Bool("retried", retried)))
+		return
+	}
+	m.successes.Add(ctx, 1, attrs)
+	m.duration.Record(ctx, result.duration().Seconds(), attrs)
+}
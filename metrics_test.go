@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectMetrics returns the sums of the counters and the counts of the
+// histograms read by reader, keyed by metric name and attributes.
+func collectMetrics(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					got[metricKey(m.Name, dp.Attributes.Encoded(attribute.DefaultEncoder()))] += dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					got[metricKey(m.Name, dp.Attributes.Encoded(attribute.DefaultEncoder()))] += int64(dp.Count)
+				}
+			}
+		}
+	}
+	return got
+}
+
+func metricKey(name, attrs string) string {
+	return name + "{" + attrs + "}"
+}
+
+func formatMetrics(metrics map[string]int64) string {
+	var lines []string
+	for key, value := range metrics {
+		lines = append(lines, fmt.Sprintf("%s=%d", key, value))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, " ")
+}
+
+func TestExecutionMetrics(t *testing.T) {
+	start := time.Now()
+	ok := runResult{script: "eod.sh", start: start, end: start.Add(2 * time.Second)}
+	failed := runResult{script: "eod.sh", err: errors.New("exit status 3"), exitCode: 3}
+	timedOut := runResult{script: "eod.sh", err: errors.New("timed out"), timedOut: true}
+	interrupted := runResult{script: "eod.sh", err: errors.New("interrupted"), interrupted: true}
+	tests := []struct {
+		name    string
+		ended   []runResult
+		retried []bool
+		running int
+		want    map[string]int64
+	}{
+		{
+			name:  "success",
+			ended: []runResult{ok, ok},
+			want: map[string]int64{
+				"ScriptRunSuccesses{script=eod.sh}": 2,
+				"ScriptRunDuration{script=eod.sh}":  2,
+				"ScriptRunsInFlight{script=eod.sh}": 0,
+			},
+		},
+		{
+			name:    "failures by reason",
+			ended:   []runResult{failed, timedOut, failed},
+			retried: []bool{true, false, false},
+			want: map[string]int64{
+				"ScriptRunFailures{reason=failed,retried=true,script=eod.sh}":     1,
+				"ScriptRunFailures{reason=failed,retried=false,script=eod.sh}":    1,
+				"ScriptRunFailures{reason=timed out,retried=false,script=eod.sh}": 1,
+				"ScriptRunsInFlight{script=eod.sh}":                               0,
+			},
+		},
+		{
+			name:  "interrupted",
+			ended: []runResult{interrupted},
+			want: map[string]int64{
+				"ScriptRunFailures{reason=interrupted,retried=false,script=eod.sh}": 1,
+				"ScriptRunsInFlight{script=eod.sh}":                                 0,
+			},
+		},
+		{
+			name:    "in flight",
+			ended:   []runResult{ok},
+			running: 2,
+			want: map[string]int64{
+				"ScriptRunSuccesses{script=eod.sh}": 1,
+				"ScriptRunDuration{script=eod.sh}":  1,
+				"ScriptRunsInFlight{script=eod.sh}": 2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		reader := sdkmetric.NewManualReader()
+		provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+		m, err := newExecutionMetrics(provider.Meter("test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < tt.running; i++ {
+			m.runStarted("eod.sh")
+		}
+		for i, result := range tt.ended {
+			m.runStarted(result.script)
+			m.runStopped(result.script)
+			m.runEnded(result, i < len(tt.retried) && tt.retried[i])
+		}
+		if got := collectMetrics(t, reader); formatMetrics(got) != formatMetrics(tt.want) {
+			t.Errorf("%s: metrics = %s, want %s", tt.name, formatMetrics(got), formatMetrics(tt.want))
+		}
+		provider.Shutdown(context.Background())
+	}
+
+	// A nil *executionMetrics, without -otel, records nothing.
+	var m *executionMetrics
+	m.runStarted("eod.sh")
+	m.runStopped("eod.sh")
+	m.runEnded(failed, false)
+}
@@ -0,0 +1,806 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// monitorOptions holds the optional settings of monitorLogs.
+type monitorOptions struct {
+	rulesFile      string
+	recordStart    string
+	eventTimeout   time.Duration
+	maxEventLines  int
+	include        string
+	exclude        string
+	maxFiles       int
+	workers        int
+	stateFile      string
+	checkpoint     time.Duration
+	alertsFile     string
+	format         string
+	before         int
+	after          int
+	contextTimeout time.Duration
+
+	recordStartRe *regexp.Regexp
+	includeGlobs  []string
+	excludeGlobs  []string
+}
+
+func parseMonitorOptions(args []string) (monitorOptions, error) {
+	var opts monitorOptions
+	fs := flag.NewFlagSet("monitorLogs", flag.ContinueOnError)
+	addMatchFlags(fs, &opts, "*.gz,*.zip,*.[0-9]")
+	fs.DurationVar(&opts.eventTimeout, "event-timeout", time.Second, "idle time after which a multi-line event is complete")
+	fs.IntVar(&opts.maxFiles, "max-files", 10, "maximum number of files monitored at once, the most recently modified")
+	fs.IntVar(&opts.workers, "workers", 4, "number of goroutines reading the monitored files")
+	fs.StringVar(&opts.stateFile, "state", "pac_weiyu_monitor_state.json", "file keeping the read offsets across restarts, empty to disable")
+	fs.DurationVar(&opts.checkpoint, "checkpoint-interval", 10*time.Second, "period of the saving of the read offsets")
+	fs.StringVar(&opts.alertsFile, "alerts", "", "JSON file of the alert sinks receiving the matches")
+	fs.DurationVar(&opts.contextTimeout, "context-timeout", 5*time.Second, "idle time after which a match is printed without the rest of its after lines")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if err := validateMatchOptions(&opts); err != nil {
+		return opts, err
+	}
+	if opts.eventTimeout <= 0 {
+		return opts, fmt.Errorf("-event-timeout must be positive")
+	}
+	if opts.maxFiles < 1 {
+		return opts, fmt.Errorf("-max-files must be at least 1")
+	}
+	if opts.workers < 1 {
+		return opts, fmt.Errorf("-workers must be at least 1")
+	}
+	if opts.contextTimeout <= 0 {
+		return opts, fmt.Errorf("-context-timeout must be positive")
+	}
+	if opts.checkpoint <= 0 {
+		return opts, fmt.Errorf("-checkpoint-interval must be positive")
+	}
+	return opts, nil
+}
+
+// addMatchFlags registers the options shared by monitorLogs and scanLogs,
+// which select the files and report their matching lines.
+func addMatchFlags(fs *flag.FlagSet, opts *monitorOptions, exclude string) {
+	fs.StringVar(&opts.rulesFile, "rules", "", "JSON file of the match rules")
+	fs.StringVar(&opts.recordStart, "record-start", "", "regexp matching the first line of a log record; other lines continue the record")
+	fs.IntVar(&opts.maxEventLines, "max-event-lines", 500, "maximum number of lines kept per event")
+	fs.StringVar(&opts.include, "include", "*", "comma-separated globs of the file names to read")
+	fs.StringVar(&opts.exclude, "exclude", exclude, "comma-separated globs of the file names to ignore")
+	fs.StringVar(&opts.format, "format", "text", "output format of the matches, text or json (one object per line)")
+	fs.IntVar(&opts.before, "before", 0, "number of lines printed before each match")
+	fs.IntVar(&opts.after, "after", 0, "number of lines printed after each match")
+}
+
+func validateMatchOptions(opts *monitorOptions) error {
+	if opts.recordStart != "" {
+		re, err := regexp.Compile(opts.recordStart)
+		if err != nil {
+			return fmt.Errorf("invalid -record-start %q: %v", opts.recordStart, err)
+		}
+		opts.recordStartRe = re
+	}
+	if opts.maxEventLines < 1 {
+		return fmt.Errorf("-max-event-lines must be at least 1")
+	}
+	if opts.format != "text" && opts.format != "json" {
+		return fmt.Errorf("invalid -format %q, expected text or json", opts.format)
+	}
+	if opts.before < 0 || opts.after < 0 {
+		return fmt.Errorf("-before and -after must not be negative")
+	}
+	var err error
+	if opts.includeGlobs, err = parseGlobs(opts.include); err != nil {
+		return fmt.Errorf("invalid -include: %v", err)
+	}
+	if opts.excludeGlobs, err = parseGlobs(opts.exclude); err != nil {
+		return fmt.Errorf("invalid -exclude: %v", err)
+	}
+	return nil
+}
+
+// loadMatchRules returns the rules of -rules, or the default ones.
+func loadMatchRules(opts monitorOptions) (*ruleSet, error) {
+	if opts.rulesFile == "" {
+		return defaultRules(), nil
+	}
+	return loadRules(opts.rulesFile)
+}
+
+func parseGlobs(s string) ([]string, error) {
+	var globs []string
+	for _, glob := range strings.Split(s, ",") {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("bad glob %q", glob)
+		}
+		globs = append(globs, glob)
+	}
+	return globs, nil
+}
+
+// selects reports whether the base name of path matches one of the include
+// globs and none of the exclude globs.
+func (opts monitorOptions) selects(path string) bool {
+	name := filepath.Base(path)
+	matchAny := func(globs []string) bool {
+		for _, glob := range globs {
+			if ok, _ := filepath.Match(glob, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return matchAny(opts.includeGlobs) && !matchAny(opts.excludeGlobs)
+}
+
+// fileOps are the pending operations of a monitored file.
+type fileOps int
+
+const (
+	opRead fileOps = 1 << iota
+	opFlush
+	opRotate
+	opRemove
+)
+
+// logMonitor watches the log directories with a single fsnotify watcher. Its
+// dispatcher turns the events into operations on the monitored files and
+// hands the files to a bounded pool of workers, one worker per file at a
+// time. Only the dispatcher goroutine schedules operations.
+type logMonitor struct {
+	opts    monitorOptions
+	rules   *ruleSet
+	host    string
+	watcher *fsnotify.Watcher
+	work    chan *watchedFile
+
+	// ready holds the files queued for a worker, in order.
+	ready []*watchedFile
+
+	// state saves the checkpoints, nil when disabled.
+	state *monitorState
+	// alerts sends the matches to the sinks, nil without -alerts.
+	alerts *alerter
+
+	mu          sync.Mutex
+	files       map[string]*watchedFile
+	checkpoints map[string]fileCheckpoint
+	// skipped holds the compressed files not monitored, so that they are
+	// only reported once.
+	skipped map[string]bool
+	// seen holds where to resume reading the selected files left out by
+	// the directory walk or dropped at the -max-files limit.
+	seen map[string]seenPosition
+}
+
+// seenPosition is how far a file not monitored was seen: its size when the
+// directory walk left it out, or the position reached when it was dropped,
+// with the number of the line there, 0 when unknown.
+type seenPosition struct {
+	offset int64
+	line   int
+}
+
+// watchedFile is a monitored file. The tail and grouper are only used by
+// the worker processing the file; the other fields are guarded by
+// logMonitor.mu.
+type watchedFile struct {
+	path    string
+	tail    *fileTail
+	grouper *eventGrouper
+	// context is nil without -before and -after.
+	context *contextCollector
+
+	pending  fileOps
+	queued   bool
+	modTime  time.Time
+	lastRead time.Time
+	grouping bool
+	info     os.FileInfo
+	// dropped is set when the file was dropped at the -max-files limit.
+	dropped bool
+}
+
+// startPosition tells where to start reading a file added to the monitor.
+type startPosition int
+
+const (
+	// startResume starts from the checkpoint of the file, or else from its
+	// last 100 lines, for the files found when monitorLogs starts.
+	startResume startPosition = iota
+	// startBeginning starts from the first line, for the files created
+	// while monitoring.
+	startBeginning
+	// startSeen starts from the checkpoint of the file, or else from where
+	// it was last seen, or else from its first line, for the files picked
+	// up because they were written to.
+	startSeen
+)
+
+// add starts monitoring path from the given position unless it is already
+// monitored or compressed, and reports whether it did. At the -max-files
+// limit, the least recently modified file is dropped for it. The file is
+// opened before taking the lock, which only guards adding it to the
+// monitored files.
+func (m *logMonitor) add(path string, from startPosition) bool {
+	m.mu.Lock()
+	_, ok := m.files[path]
+	skipped := m.skipped[path]
+	m.mu.Unlock()
+	if ok || skipped {
+		return false
+	}
+	// Compressed rotations never grow, scanLogs searches them.
+	if isCompressedLog(path) {
+		m.mu.Lock()
+		m.skipped[path] = true
+		m.mu.Unlock()
+		writeLog(logfile, fmt.Sprintf("Not monitoring compressed file %s, scanLogs reads it\n", path))
+		return false
+	}
+
+	var startPos int64
+	var startLine int
+	var err error
+	switch from {
+	case startResume:
+		startPos, startLine, err = m.startOffset(path)
+	case startSeen:
+		startPos, startLine, err = m.seenOffset(path)
+	}
+	if err != nil {
+		fmt.Println("Error watching file:", err)
+		return false
+	}
+	tail, err := openFileTail(path, startPos, startLine)
+	if err != nil {
+		fmt.Println("Error watching file:", err)
+		return false
+	}
+	wf := &watchedFile{
+		path:    path,
+		tail:    tail,
+		grouper: newEventGrouper(m.opts.recordStartRe, m.opts.maxEventLines),
+		modTime: time.Now(),
+	}
+	if m.opts.before > 0 || m.opts.after > 0 {
+		wf.context = newContextCollector(m.opts.before, m.opts.after)
+	}
+	wf.info, _ = tail.stat()
+
+	m.mu.Lock()
+	if _, ok := m.files[path]; ok {
+		m.mu.Unlock()
+		tail.close()
+		return false
+	}
+	var evicted *watchedFile
+	if len(m.files) >= m.opts.maxFiles {
+		for _, other := range m.files {
+			if evicted == nil || other.modTime.Before(evicted.modTime) {
+				evicted = other
+			}
+		}
+		delete(m.files, evicted.path)
+		evicted.dropped = true
+		if evicted.info != nil {
+			// The worker records the exact position once it read the rest.
+			m.seen[evicted.path] = seenPosition{offset: evicted.info.Size()}
+		}
+		m.scheduleLocked(evicted, opRemove)
+	}
+	delete(m.seen, path)
+	m.files[path] = wf
+	m.scheduleLocked(wf, opRead)
+	m.mu.Unlock()
+	if evicted != nil {
+		writeLog(logfile, fmt.Sprintf("Stopped monitoring %s to stay within %d files\n", evicted.path, m.opts.maxFiles))
+	}
+	return true
+}
+
+// startOffset returns where to start reading an existing file, with the
+// number of the line there if known. A file replaced since its checkpoint
+// was taken is read from the start, so that no line written while
+// monitorLogs was down is missed, and a file renamed by a rotation resumes
+// from the checkpoint of its former path.
+func (m *logMonitor) startOffset(path string) (int64, int, error) {
+	m.mu.Lock()
+	cp, ok := m.checkpoints[path]
+	var others []fileCheckpoint
+	if !ok {
+		for _, other := range m.checkpoints {
+			others = append(others, other)
+		}
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		for _, cp := range others {
+			if offset, same, err := resumeOffset(path, cp); err == nil && same {
+				return offset, cp.Line, nil
+			}
+		}
+		return getLast100thLinePos(path)
+	}
+	offset, same, err := resumeOffset(path, cp)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !same {
+		writeLog(logfile, fmt.Sprintf("%s was replaced since its checkpoint, reading it from the start\n", path))
+		return 0, 1, nil
+	}
+	return offset, cp.Line, nil
+}
+
+// seenOffset returns where to start reading a file picked up because it
+// was written to: from its checkpoint, or else from the start of the line
+// where it was last seen, so that the lines of the write that triggered it
+// and of the writes made while it was not monitored are all read. A file
+// never seen is read from its first line.
+func (m *logMonitor) seenOffset(path string) (int64, int, error) {
+	m.mu.Lock()
+	cp, checkpointed := m.checkpoints[path]
+	pos, seen := m.seen[path]
+	m.mu.Unlock()
+
+	if checkpointed {
+		offset, same, err := resumeOffset(path, cp)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !same {
+			return 0, 1, nil
+		}
+		return offset, cp.Line, nil
+	}
+	if !seen {
+		return 0, 1, nil
+	}
+	start, err := lineStartBefore(path, pos.offset)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start != pos.offset {
+		return start, 0, nil
+	}
+	return pos.offset, pos.line, nil
+}
+
+// scheduleLocked records ops for wf and queues it unless a worker already
+// has it, in which case the worker picks the ops up before releasing it.
+func (m *logMonitor) scheduleLocked(wf *watchedFile, ops fileOps) {
+	wf.pending |= ops
+	if !wf.queued {
+		wf.queued = true
+		m.ready = append(m.ready, wf)
+	}
+}
+
+// worker processes the files handed over by the dispatcher until the work
+// channel is closed.
+func (m *logMonitor) worker(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for wf := range m.work {
+		for {
+			m.mu.Lock()
+			ops := wf.pending
+			wf.pending = 0
+			if ops == 0 {
+				wf.queued = false
+				m.mu.Unlock()
+				break
+			}
+			m.mu.Unlock()
+			m.process(wf, ops)
+		}
+	}
+}
+
+func (m *logMonitor) process(wf *watchedFile, ops fileOps) {
+	report := func(match *logMatch) {
+		if match == nil {
+			return
+		}
+		// One Print per match keeps the lines of a trace together.
+		fmt.Print(formatMatch(m.opts.format, m.host, wf.path, match))
+		if m.alerts != nil {
+			m.alerts.alert(wf.path, match.rule.Name, match.rule.Severity, match.event.lines)
+		}
+	}
+	printEvent := func(event *logEvent) {
+		if event == nil {
+			return
+		}
+		rule := m.rules.matchEvent(wf.path, event)
+		if wf.context != nil {
+			report(wf.context.add(event, rule))
+		} else if rule != nil {
+			report(&logMatch{rule: rule, event: event})
+		}
+	}
+	// flush completes the pending event and, with force or once the file
+	// stayed idle for the context timeout, the match waiting for context.
+	flush := func(force bool) {
+		printEvent(wf.grouper.flush())
+		if wf.context == nil {
+			return
+		}
+		m.mu.Lock()
+		idle := time.Since(wf.lastRead)
+		m.mu.Unlock()
+		if force || idle >= m.opts.contextTimeout {
+			report(wf.context.flush())
+		}
+	}
+	printLines := func(lines []tailLine, err error) {
+		if err != nil {
+			writeLog(logfile, "error reading file: "+err.Error())
+			return
+		}
+		for _, line := range lines {
+			printEvent(wf.grouper.add(line))
+		}
+	}
+
+	switch {
+	case ops&opRemove != 0:
+		printLines(wf.tail.drain())
+		flush(true)
+		m.recordCheckpoint(wf)
+		if wf.dropped {
+			m.mu.Lock()
+			if _, ok := m.files[wf.path]; !ok {
+				m.seen[wf.path] = seenPosition{offset: wf.tail.lineStart, line: wf.tail.lineNumber}
+			}
+			m.mu.Unlock()
+		}
+		wf.tail.close()
+		return
+	case ops&opRotate != 0:
+		// Finish the rotated file, then follow the new one.
+		printLines(wf.tail.drain())
+		flush(true)
+		if err := wf.tail.reopen(); err != nil {
+			writeLog(logfile, "error reading file: "+err.Error())
+			return
+		}
+		writeLog(logfile, fmt.Sprintf("Following rotated file %s\n", wf.path))
+		printLines(wf.tail.readLines())
+	case ops&opRead != 0:
+		printLines(wf.tail.readLines())
+	case ops&opFlush != 0:
+		flush(false)
+	}
+
+	m.recordCheckpoint(wf)
+	info, _ := wf.tail.stat()
+	m.mu.Lock()
+	if ops&(opRead|opRotate) != 0 {
+		wf.lastRead = time.Now()
+	}
+	wf.grouping = wf.grouper.pending != nil || (wf.context != nil && wf.context.holding())
+	if info != nil {
+		wf.info = info
+	}
+	m.mu.Unlock()
+}
+
+func (m *logMonitor) recordCheckpoint(wf *watchedFile) {
+	if m.state == nil {
+		return
+	}
+	cp, err := wf.tail.checkpoint()
+	if err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to checkpoint %s: %v\n", wf.path, err))
+		return
+	}
+	m.mu.Lock()
+	// A file dropped after a new one took its path must not overwrite the
+	// checkpoint of the new one.
+	if other, ok := m.files[wf.path]; !ok || other == wf {
+		m.checkpoints[wf.path] = cp
+	}
+	m.mu.Unlock()
+}
+
+// saveCheckpoints writes the checkpoints to the state file.
+func (m *logMonitor) saveCheckpoints() {
+	if m.state == nil {
+		return
+	}
+	m.mu.Lock()
+	files := make(map[string]fileCheckpoint, len(m.checkpoints))
+	for path, cp := range m.checkpoints {
+		files[path] = cp
+	}
+	m.mu.Unlock()
+	if err := m.state.save(files); err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to save checkpoints to %s: %v\n", m.state.path, err))
+	}
+}
+
+// dispatch turns the watcher events into file operations and feeds the
+// workers until ctx is done. The last event of a burst of writes is only
+// complete once its file stays idle for the event timeout, which a ticker
+// checks.
+func (m *logMonitor) dispatch(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.eventTimeout / 2)
+	defer ticker.Stop()
+	checkpoints := time.NewTicker(m.opts.checkpoint)
+	defer checkpoints.Stop()
+	for {
+		var work chan *watchedFile
+		var next *watchedFile
+		m.mu.Lock()
+		if len(m.ready) > 0 {
+			work, next = m.work, m.ready[0]
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case work <- next:
+			m.mu.Lock()
+			m.ready = m.ready[1:]
+			m.mu.Unlock()
+		case event, ok := <-m.watcher.Events:
+			if !ok {
+				return
+			}
+			m.handle(event)
+		case <-ticker.C:
+			m.mu.Lock()
+			for _, wf := range m.files {
+				if wf.grouping && time.Since(wf.lastRead) >= m.opts.eventTimeout {
+					wf.grouping = false
+					m.scheduleLocked(wf, opFlush)
+				}
+			}
+			m.mu.Unlock()
+		case <-checkpoints.C:
+			m.saveCheckpoints()
+		case err, ok := <-m.watcher.Errors:
+			if !ok {
+				return
+			}
+			writeLog(logfile, "error: "+err.Error())
+		}
+	}
+}
+
+func (m *logMonitor) handle(event fsnotify.Event) {
+	m.mu.Lock()
+	wf, ok := m.files[event.Name]
+	m.mu.Unlock()
+
+	switch {
+	case event.Op&fsnotify.Create == fsnotify.Create:
+		if ok {
+			m.mu.Lock()
+			m.scheduleLocked(wf, opRotate)
+			m.mu.Unlock()
+			return
+		}
+		m.created(event.Name)
+	case event.Op&fsnotify.Write == fsnotify.Write:
+		if ok {
+			m.mu.Lock()
+			wf.modTime = time.Now()
+			m.scheduleLocked(wf, opRead)
+			m.mu.Unlock()
+		} else if m.opts.selects(event.Name) && m.add(event.Name, startSeen) {
+			writeLog(logfile, fmt.Sprintf("Monitoring written file %s\n", event.Name))
+		}
+	case event.Op&fsnotify.Remove == fsnotify.Remove:
+		m.mu.Lock()
+		delete(m.skipped, event.Name)
+		delete(m.seen, event.Name)
+		m.mu.Unlock()
+		if ok {
+			m.mu.Lock()
+			delete(m.files, event.Name)
+			m.scheduleLocked(wf, opRemove)
+			m.mu.Unlock()
+			writeLog(logfile, fmt.Sprintf("Stopped monitoring deleted file %s\n", event.Name))
+		}
+	}
+}
+
+func (m *logMonitor) created(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		// Files may have been created before the directory was watched.
+		filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if err := m.watcher.Add(p); err != nil {
+					writeLog(logfile, "error: "+err.Error())
+				}
+			} else if m.opts.selects(p) {
+				m.add(p, startBeginning)
+			}
+			return nil
+		})
+		return
+	}
+	if m.opts.selects(path) && !m.followed(info) && m.add(path, startBeginning) {
+		writeLog(logfile, fmt.Sprintf("Monitoring new file %s\n", path))
+	}
+}
+
+// followed reports whether info describes a file already being read, such
+// as a file renamed by a rotation.
+func (m *logMonitor) followed(info os.FileInfo) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, wf := range m.files {
+		if wf.info != nil && os.SameFile(wf.info, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// shutdown has the workers print what remains of every file, then stops
+// them.
+func (m *logMonitor) shutdown(wg *sync.WaitGroup) {
+	m.mu.Lock()
+	for path, wf := range m.files {
+		delete(m.files, path)
+		m.scheduleLocked(wf, opRemove)
+	}
+	ready := m.ready
+	m.ready = nil
+	m.mu.Unlock()
+
+	for _, wf := range ready {
+		m.work <- wf
+	}
+	close(m.work)
+	wg.Wait()
+}
+
+// monitorLogs prints the matching lines of the most recently modified files
+// in the logs directory until SIGINT or SIGTERM.
+func monitorLogs(opts monitorOptions) {
+	rules, err := loadMatchRules(opts)
+	if err != nil {
+		fmt.Println("Error loading rules:", err)
+		os.Exit(1)
+	}
+
+	dir := "logs"
+	_, err = ioutil.ReadDir(dir)
+	if err != nil {
+		fmt.Println("Error reading directory:", err)
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Println("Error watching directory:", err)
+		return
+	}
+	defer watcher.Close()
+
+	type FileInfo struct {
+		Path    string
+		ModTime time.Time
+		Size    int64
+	}
+
+	var logFiles []FileInfo
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Watching the directories also reports the writes to their files
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		if opts.selects(path) {
+			logFiles = append(logFiles, FileInfo{Path: path, ModTime: info.ModTime(), Size: info.Size()})
+		}
+
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error watching directory:", err)
+		return
+	}
+
+	// Sort the files by modification time
+	sort.Slice(logFiles, func(i, j int) bool {
+		return logFiles[i].ModTime.Before(logFiles[j].ModTime)
+	})
+
+	// Take the latest files up to the limit
+	var leftOut []FileInfo
+	if len(logFiles) > opts.maxFiles {
+		leftOut = logFiles[:len(logFiles)-opts.maxFiles]
+		logFiles = logFiles[len(logFiles)-opts.maxFiles:]
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m := &logMonitor{
+		opts:        opts,
+		rules:       rules,
+		watcher:     watcher,
+		work:        make(chan *watchedFile),
+		files:       make(map[string]*watchedFile),
+		checkpoints: make(map[string]fileCheckpoint),
+		skipped:     make(map[string]bool),
+		seen:        make(map[string]seenPosition),
+	}
+	m.host, _ = os.Hostname()
+	for _, file := range leftOut {
+		m.seen[file.Path] = seenPosition{offset: file.Size}
+	}
+	if opts.stateFile != "" {
+		state, err := loadMonitorState(opts.stateFile)
+		if err != nil {
+			fmt.Println("Error loading checkpoints:", err)
+			os.Exit(1)
+		}
+		m.state = state
+		for path, cp := range state.Files {
+			m.checkpoints[path] = cp
+		}
+	}
+	if opts.alertsFile != "" {
+		alerts, err := loadAlerter(opts.alertsFile)
+		if err != nil {
+			fmt.Println("Error loading alert sinks:", err)
+			os.Exit(1)
+		}
+		m.alerts = alerts
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go m.worker(&wg)
+	}
+	for _, file := range logFiles {
+		m.add(file.Path, startResume)
+	}
+	m.dispatch(ctx)
+	m.shutdown(&wg)
+	m.saveCheckpoints()
+	if m.alerts != nil {
+		m.alerts.close()
+	}
+	writeLog(logfile, "Stopped monitoring logs\n")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func newTestMonitor(maxFiles int) *logMonitor {
+	return &logMonitor{
+		opts:        monitorOptions{maxFiles: maxFiles, maxEventLines: 500, includeGlobs: []string{"*.log"}},
+		rules:       defaultRules(),
+		files:       make(map[string]*watchedFile),
+		checkpoints: make(map[string]fileCheckpoint),
+		skipped:     make(map[string]bool),
+		seen:        make(map[string]seenPosition),
+	}
+}
+
+func TestLogMonitorStartPositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    startPosition
+		partial string
+		want    tailLine
+	}{
+		{"resume without checkpoint", startResume, "", tailLine{"line 101", 792, 101}},
+		{"beginning", startBeginning, "", tailLine{"line 1", 0, 1}},
+		{"never seen", startSeen, "", tailLine{"line 1", 0, 1}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "app.log")
+		writeLines(t, path, 200, tt.partial)
+		m := newTestMonitor(10)
+		m.add(path, tt.from)
+		wf := m.files[path]
+		if wf == nil {
+			t.Fatalf("%s: %s not monitored", tt.name, path)
+		}
+		appendFile(t, path, "new\n")
+		lines, err := wf.tail.readLines()
+		if err != nil || len(lines) == 0 || lines[0] != tt.want {
+			t.Errorf("%s: first line read = %v, %v, want %v", tt.name, lines, err, tt.want)
+		}
+		wf.tail.close()
+	}
+}
+
+func TestLogMonitorResumesCheckpointLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	writeLines(t, path, 200, "")
+	first := newTestMonitor(10)
+	first.state = &monitorState{}
+	first.add(path, startResume)
+	wf := first.files[path]
+	if _, err := wf.tail.readLines(); err != nil {
+		t.Fatal(err)
+	}
+	first.recordCheckpoint(wf)
+	wf.tail.close()
+
+	appendFile(t, path, "new\n")
+	second := newTestMonitor(10)
+	second.checkpoints = first.checkpoints
+	second.add(path, startResume)
+	lines, err := second.files[path].tail.readLines()
+	want := tailLine{"new", 1692, 201}
+	if err != nil || len(lines) != 1 || lines[0] != want {
+		t.Errorf("lines read after resuming = %v, %v, want %v", lines, err, want)
+	}
+	second.files[path].tail.close()
+}
+
+func TestLogMonitorWriteToUnknownFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxFiles int
+		evicted  string
+	}{
+		{"below the limit", 3, ""},
+		{"at the limit", 2, "old.log"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		m := newTestMonitor(tt.maxFiles)
+		for i, name := range []string{"old.log", "recent.log"} {
+			path := filepath.Join(dir, name)
+			writeLines(t, path, 1, "")
+			m.add(path, startBeginning)
+			m.files[path].modTime = time.Now().Add(time.Duration(i-2) * time.Minute)
+		}
+
+		// The directory walk left the file out at its first 150 lines.
+		path := filepath.Join(dir, "written.log")
+		writeLines(t, path, 150, "")
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.seen[path] = seenPosition{offset: info.Size()}
+		appendFile(t, path, "ERROR in written\n")
+		m.handle(fsnotify.Event{Name: path, Op: fsnotify.Write})
+		wf := m.files[path]
+		if wf == nil {
+			t.Fatalf("%s: written file not monitored", tt.name)
+		}
+		want := tailLine{"ERROR in written", info.Size(), 151}
+		if lines, err := wf.tail.readLines(); err != nil || len(lines) != 1 || lines[0] != want {
+			t.Errorf("%s: written file lines = %v, %v, want %v", tt.name, lines, err, want)
+		}
+		if len(m.files) > tt.maxFiles {
+			t.Errorf("%s: %d files monitored, more than %d", tt.name, len(m.files), tt.maxFiles)
+		}
+		if tt.evicted != "" {
+			evicted := filepath.Join(dir, tt.evicted)
+			if _, ok := m.files[evicted]; ok {
+				t.Errorf("%s: %s still monitored", tt.name, tt.evicted)
+			}
+			var dropped *watchedFile
+			for _, wf := range m.ready {
+				if wf.path == evicted && wf.pending&opRemove != 0 {
+					dropped = wf
+				}
+			}
+			if dropped == nil {
+				t.Fatalf("%s: %s not scheduled for removal", tt.name, tt.evicted)
+			}
+			appendFile(t, evicted, "read when dropped\n")
+			m.process(dropped, opRemove)
+
+			// Written again, the dropped file resumes where it was dropped.
+			appendFile(t, evicted, "ERROR while dropped\n")
+			m.handle(fsnotify.Event{Name: evicted, Op: fsnotify.Write})
+			wf := m.files[evicted]
+			if wf == nil {
+				t.Fatalf("%s: %s not monitored again", tt.name, tt.evicted)
+			}
+			want := tailLine{"ERROR while dropped", 25, 3}
+			if lines, err := wf.tail.readLines(); err != nil || len(lines) != 1 || lines[0] != want {
+				t.Errorf("%s: lines read again = %v, %v, want %v", tt.name, lines, err, want)
+			}
+		}
+		for _, wf := range m.files {
+			wf.tail.close()
+		}
+	}
+}
+
+func TestLogMonitorSeenOffset(t *testing.T) {
+	tests := []struct {
+		name       string
+		seen       *seenPosition
+		checkpoint int64
+		want       tailLine
+	}{
+		{name: "never seen", want: tailLine{"line 1", 0, 1}},
+		{name: "seen at a line end", seen: &seenPosition{offset: 1692}, want: tailLine{"new", 1692, 201}},
+		{name: "seen within a line", seen: &seenPosition{offset: 795}, want: tailLine{"line 101", 792, 101}},
+		{name: "dropped with its line", seen: &seenPosition{offset: 792, line: 101}, want: tailLine{"line 101", 792, 101}},
+		{name: "truncated since seen", seen: &seenPosition{offset: 5000}, want: tailLine{"line 1", 0, 1}},
+		{name: "checkpoint first", seen: &seenPosition{offset: 1692}, checkpoint: 792, want: tailLine{"line 101", 792, 101}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "app.log")
+		writeLines(t, path, 200, "")
+		m := newTestMonitor(10)
+		if tt.seen != nil {
+			m.seen[path] = *tt.seen
+		}
+		if tt.checkpoint > 0 {
+			tail, err := openFileTail(path, tt.checkpoint, 101)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cp, err := tail.checkpoint()
+			tail.close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.checkpoints[path] = cp
+		}
+		m.add(path, startSeen)
+		wf := m.files[path]
+		if wf == nil {
+			t.Fatalf("%s: %s not monitored", tt.name, path)
+		}
+		appendFile(t, path, "new\n")
+		lines, err := wf.tail.readLines()
+		if err != nil || len(lines) == 0 || lines[0] != tt.want {
+			t.Errorf("%s: first line read = %v, %v, want %v", tt.name, lines, err, tt.want)
+		}
+		if _, ok := m.seen[path]; ok {
+			t.Errorf("%s: position still recorded once monitored", tt.name)
+		}
+		wf.tail.close()
+	}
+}
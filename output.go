@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// matchRecord is a match printed by monitorLogs -format json, one object
+// per line. Raw holds the whole event, continuation lines included, and
+// Context the lines around it with -before or -after.
+type matchRecord struct {
+	File      string        `json:"file"`
+	Offset    int64         `json:"offset"`
+	Line      int           `json:"line"`
+	Rule      string        `json:"rule"`
+	Severity  string        `json:"severity"`
+	Timestamp *time.Time    `json:"timestamp,omitempty"`
+	Host      string        `json:"host"`
+	Raw       string        `json:"raw"`
+	Context   []contextLine `json:"context,omitempty"`
+}
+
+// formatMatch renders a match in the -format of monitorLogs, with a
+// trailing newline. Context lines are numbered like grep, with ':' for the
+// matching lines and '-' for the others.
+func formatMatch(format, host, path string, match *logMatch) string {
+	rule, event := match.rule, match.event
+	if format == "json" {
+		record := matchRecord{
+			File:     path,
+			Offset:   event.offset,
+			Line:     event.number,
+			Rule:     rule.Name,
+			Severity: rule.Severity,
+			Host:     host,
+			Raw:      strings.Join(event.lines, "\n"),
+			Context:  match.context,
+		}
+		if t, ok := parseLogTimestamp(event.summary()); ok {
+			record.Timestamp = &t
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Sprintf("{\"error\":%q}\n", err.Error())
+		}
+		return string(data) + "\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: [%s/%s] %s\n", path, rule.Name, rule.Severity, event.summary())
+	if match.context != nil {
+		for _, line := range match.context {
+			sep := "-"
+			if line.Match {
+				sep = ":"
+			}
+			fmt.Fprintf(&b, "    %d%s%s\n", line.Line, sep, line.Text)
+		}
+		return b.String()
+	}
+	for _, line := range event.lines[1:] {
+		fmt.Fprintf(&b, "    %s\n", line)
+	}
+	return b.String()
+}
+
+// timestampFormats are the timestamps recognised at the start of a log
+// line, possibly in brackets, with the layouts parsing them. Fractional
+// seconds are accepted by time.Parse after the seconds of any layout.
+var timestampFormats = []struct {
+	re      *regexp.Regexp
+	layouts []string
+}{
+	{
+		// ISO 8601, as written by log4j, logback and most services.
+		regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?)`),
+		[]string{
+			"2006-01-02T15:04:05Z07:00", "2006-01-02 15:04:05Z07:00",
+			"2006-01-02T15:04:05Z0700", "2006-01-02 15:04:05Z0700",
+			"2006-01-02T15:04:05", "2006-01-02 15:04:05",
+		},
+	},
+	{
+		// Go's log package.
+		regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?)`),
+		[]string{"2006/01/02 15:04:05"},
+	},
+	{
+		// Syslog, without a year.
+		regexp.MustCompile(`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2})`),
+		[]string{"Jan _2 15:04:05"},
+	},
+}
+
+// parseLogTimestamp parses the timestamp starting line. Timestamps without
+// a zone are taken as local time, and syslog ones as of the current year.
+func parseLogTimestamp(line string) (time.Time, bool) {
+	t, _, ok := findLogTimestamp(line)
+	return t, ok
+}
+
+// stripLogTimestamp returns line without its leading timestamp, so that the
+// repetitions of a message compare equal.
+func stripLogTimestamp(line string) string {
+	if _, end, ok := findLogTimestamp(line); ok {
+		return strings.TrimLeft(line[end:], "] \t")
+	}
+	return line
+}
+
+// findLogTimestamp parses the timestamp starting line and returns where it
+// ends.
+func findLogTimestamp(line string) (time.Time, int, bool) {
+	for _, format := range timestampFormats {
+		m := format.re.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+		// log4j separates the milliseconds with a comma.
+		s := strings.Replace(line[m[2]:m[3]], ",", ".", 1)
+		for _, layout := range format.layouts {
+			t, err := time.ParseInLocation(layout, s, time.Local)
+			if err != nil {
+				continue
+			}
+			if t.Year() == 0 {
+				t = t.AddDate(time.Now().Year(), 0, 0)
+			}
+			return t, m[1], true
+		}
+	}
+	return time.Time{}, 0, false
+}
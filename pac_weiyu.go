@@ -7,20 +7,17 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/metric"
 )
@@ -41,9 +38,16 @@ func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: ./pac_weiyu <function> [arguments]")
 		fmt.Println("\nFunctions:")
-		fmt.Println("  executeAndTime <script> <times> <pacingTime>")
+		fmt.Println("  executeAndTime <script> <times> <pacingTime> [options]")
+		fmt.Println("  executeScenario <scenarioFile> <times> <pacingTime> [options]")
+		fmt.Println("  executeAtRate <script> <rate> <duration> [options]")
+		fmt.Println("  saveBaseline <seriesID> <name> [resultsDir]")
+		fmt.Println("  compareSeries <baselineName> [seriesID] [resultsDir]")
+		fmt.Println("  reportLog [logFile] [htmlFile]")
+		fmt.Println("  runWorkflow <workflowFile> [options]")
 		fmt.Println("  getStack <coreFile>")
-		fmt.Println("  monitorLogs")
+		fmt.Println("  monitorLogs [options] (see monitorLogs -h)")
+		fmt.Println("  scanLogs <dir> [options] (see scanLogs <dir> -h)")
 		fmt.Println("  retrieveStackAndPackLogFiles")
 		fmt.Println("  writeStackToFile <coreFile>")
 		fmt.Println("  getJavaHeapSize <pid>")
@@ -56,14 +60,139 @@ func main() {
 
 	// Call the function based on the first argument
 	switch os.Args[1] {
-	case "executeAndTime":
+	case "executeAndTime", "executeScenario":
 		if len(os.Args) < 5 {
-			fmt.Println("Usage: ./pac_weiyu executeAndTime <script> <times> <pacingTime>")
+			fmt.Println("Usage: ./pac_weiyu executeAndTime <script> <times> <pacingTime> [options]")
+			fmt.Println("       ./pac_weiyu executeScenario <scenarioFile> <times> <pacingTime> [options]")
+			fmt.Println("\nA scenario file is a JSON document listing scripts with their name, weight, args, env, dir and interpreter.")
+			fmt.Println("\n<times> may be 0 with -duration or -stages; <pacingTime> is in seconds (e.g. 0.5) or a duration (e.g. 500ms).")
+			fmt.Println("\nOptions:")
+			fmt.Println("  -workers <n>           number of concurrent virtual users (default 1)")
+			fmt.Println("  -duration <duration>   run for this wall-clock duration instead of <times> runs")
+			fmt.Println("  -stages <stages>       ramp-up/ramp-down stages, e.g. 1m:2,5m:10,1m:0 (overrides -workers)")
+			fmt.Println("  -think <think time>    random delay added to the pacing: uniform:1s-3s or exponential:2s")
+			fmt.Println("  -data <file>           CSV file whose rows, named by the header row, are bound to the runs")
+			fmt.Println("  -data-mode <mode>      sequential, random or unique (rows split between workers) (default sequential)")
+			fmt.Println("  -data-bind <binding>   pass a row as env variables or as extra args (default env)")
+			fmt.Println("  -on-data-end <policy>  stop or recycle when the rows are exhausted (default stop)")
+			fmt.Println("  -grace <duration>      on SIGINT/SIGTERM, wait this long for running runs before killing them (default 30s)")
+			fmt.Println("  -resume                resume the series interrupted by the previous invocation")
+			fmt.Println("  -state <file>          file recording the progress of the series (default <script>.series_state.json)")
+			printRunOptionsUsage()
 			os.Exit(1)
 		}
-		times, _ := strconv.Atoi(os.Args[3])      // Convert os.Args[3] to int
-		pacingTime, _ := strconv.Atoi(os.Args[4]) // Convert os.Args[4] to int
-		executeAndTime(os.Args[2], times, pacingTime)
+		times, _ := strconv.Atoi(os.Args[3]) // Convert os.Args[3] to int
+		pacing, err := parsePacing(os.Args[4])
+		if err != nil {
+			fmt.Println("Error parsing pacing time:", err)
+			os.Exit(1)
+		}
+		opts, err := parseExecuteOptions(os.Args[5:])
+		if err != nil {
+			fmt.Println("Error parsing options:", err)
+			os.Exit(1)
+		}
+		if os.Args[1] == "executeScenario" {
+			err = executeScenario(os.Args[2], times, pacing, opts)
+		} else {
+			err = executeAndTime(os.Args[2], times, pacing, opts)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	case "executeAtRate":
+		if len(os.Args) < 5 {
+			fmt.Println("Usage: ./pac_weiyu executeAtRate <script> <rate> <duration> [options]")
+			fmt.Println("\n<rate> is the number of runs started per second (e.g. 2 or 0.5), <duration> a duration (e.g. 10m).")
+			fmt.Println("\nOptions:")
+			fmt.Println("  -max-inflight <n>      maximum number of runs in flight, further arrivals are dropped (default 10)")
+			printRunOptionsUsage()
+			os.Exit(1)
+		}
+		rate, err := strconv.ParseFloat(os.Args[3], 64)
+		if err != nil {
+			fmt.Println("Error parsing rate:", err)
+			os.Exit(1)
+		}
+		duration, err := time.ParseDuration(os.Args[4])
+		if err != nil {
+			fmt.Println("Error parsing duration:", err)
+			os.Exit(1)
+		}
+		opts, err := parseRateOptions(os.Args[5:])
+		if err != nil {
+			fmt.Println("Error parsing options:", err)
+			os.Exit(1)
+		}
+		if err := executeAtRate(os.Args[2], rate, duration, opts); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	case "saveBaseline":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: ./pac_weiyu saveBaseline <seriesID> <name> [resultsDir]")
+			os.Exit(1)
+		}
+		resultsDir := "results"
+		if len(os.Args) > 4 {
+			resultsDir = os.Args[4]
+		}
+		if err := saveBaseline(resultsDir, os.Args[2], os.Args[3]); err != nil {
+			fmt.Println("Error saving baseline:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Series %s saved as baseline %s\n", os.Args[2], os.Args[3])
+	case "compareSeries":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: ./pac_weiyu compareSeries <baselineName> [seriesID] [resultsDir]")
+			fmt.Println("\nWithout seriesID, the latest series of the baseline's script is compared.")
+			os.Exit(1)
+		}
+		seriesID, resultsDir := "", "results"
+		if len(os.Args) > 3 {
+			seriesID = os.Args[3]
+		}
+		if len(os.Args) > 4 {
+			resultsDir = os.Args[4]
+		}
+		if err := compareSeries(resultsDir, os.Args[2], seriesID); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	case "runWorkflow":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: ./pac_weiyu runWorkflow <workflowFile> [options]")
+			fmt.Println("\nA workflow file is a JSON document listing steps with their name, script, depends_on, timeout and retries.")
+			fmt.Println("\nOptions:")
+			fmt.Println("  -concurrency <n>       maximum number of steps running at the same time (default 4)")
+			fmt.Println("  -resume                skip the steps completed by the previous invocation")
+			fmt.Println("  -state <file>          file recording the completed steps (default <workflowFile>.state.json)")
+			fmt.Println("  -output-dir <dir>      directory receiving the stdout and stderr of each step (default runs)")
+			os.Exit(1)
+		}
+		opts, err := parseWorkflowOptions(os.Args[2], os.Args[3:])
+		if err != nil {
+			fmt.Println("Error parsing options:", err)
+			os.Exit(1)
+		}
+		if err := runWorkflow(os.Args[2], opts); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	case "reportLog":
+		logPath, outPath := "pac_weiyu.log", "pac_weiyu_report.html"
+		if len(os.Args) > 2 {
+			logPath = os.Args[2]
+		}
+		if len(os.Args) > 3 {
+			outPath = os.Args[3]
+		}
+		if err := writeRunReport(logPath, outPath); err != nil {
+			fmt.Println("Error writing report:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Report written to", outPath)
 	case "retrieveStackAndPackLogFiles":
 		retrieveStackAndPackLogFiles()
 	case "getStack":
@@ -88,7 +217,27 @@ func main() {
 			os.Exit(1)
 		}
 	case "monitorLogs":
-		monitorLogs()
+		opts, err := parseMonitorOptions(os.Args[2:])
+		if err != nil {
+			fmt.Println("Error parsing options:", err)
+			os.Exit(1)
+		}
+		monitorLogs(opts)
+	case "scanLogs":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: ./pac_weiyu scanLogs <dir> [options]")
+			fmt.Println("\nApplies the monitorLogs rules once to every file under dir, including gzip-compressed ones.")
+			os.Exit(1)
+		}
+		opts, err := parseScanOptions(os.Args[3:])
+		if err != nil {
+			fmt.Println("Error parsing options:", err)
+			os.Exit(1)
+		}
+		if err := scanLogs(os.Args[2], opts); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
 	case "getJavaHeapSize": // Add case for getJavaHeapSize
 		if len(os.Args) < 3 {
 			fmt.Println("Usage: ./pac_weiyu getJavaHeapSize <pid>")
@@ -176,157 +325,61 @@ func main() {
 	defer logfile.Close()
 }
 
+func printRunOptionsUsage() {
+	fmt.Println("  -timeout <duration>    kill a run and its process group after this long")
+	fmt.Println("  -on-timeout <policy>   stop, continue or retry after a timeout (default stop)")
+	fmt.Println("  -on-failure <policy>   stop, continue or retry after a non-zero exit (default stop)")
+	fmt.Println("  -retries <n>           retries of a run before giving up with the retry policy (default 3)")
+	fmt.Println("  -backoff <duration>    delay before the first retry, doubled for each further retry (default 1s)")
+	fmt.Println("  -output-dir <dir>      directory receiving the stdout and stderr of each run (default runs)")
+	fmt.Println("  -sample-interval <d>   period of the memory and I/O sampling of each run (default 200ms)")
+	fmt.Println("  -otel                  serve run duration histograms and counters at localhost:9000/metrics")
+	fmt.Println("  -assert <assertion>    SLA such as p95<30s, max<120s or error_rate<1%, may be repeated;")
+	fmt.Println("                         the command exits with status 1 when one fails, or without")
+	fmt.Println("                         assertions when a run failed or timed out")
+	fmt.Println("  -label <key=value>     label stored with the series, e.g. build=1234, may be repeated")
+	fmt.Println("  -results-dir <dir>     directory storing the result record of each series (default results)")
+}
+
 func writeLog(logfile *os.File, message string) {
+	mu.Lock()
+	defer mu.Unlock()
 	_, err := fmt.Fprint(logfile, message)
 	if err != nil {
 		fmt.Printf("Error writing to log file: %v\n", err)
 	}
 }
 
-func getLast100thLinePos(filePath string) (int64, error) {
+// getLast100thLinePos returns the offset and the number of the 100th line
+// from the end of the file.
+func getLast100thLinePos(filePath string) (int64, int, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 	var lines []int64
 	var pos int64
+	count := 0
 	for scanner.Scan() {
 		lines = append(lines, pos)
 		pos += int64(len(scanner.Bytes())) + 1 // +1 for newline character
+		count++
 		if len(lines) > 100 {
 			lines = lines[1:]
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	if len(lines) == 0 {
-		return 0, nil
+		return 0, 1, nil
 	}
 
-	return lines[0], nil
-}
-
-func watchFile(filePath string, logfile *os.File) error {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
-	}
-	defer watcher.Close()
-
-	var lastPos int64 = 0
-	done := make(chan bool)
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				//writeLog(logfile, "event: "+event.String())
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					//writeLog(logfile, "modified file: "+event.Name)
-					file, err := os.Open(event.Name)
-					if err != nil {
-						writeLog(logfile, "error opening file: "+err.Error())
-						continue
-					}
-					lastPos, err = getLast100thLinePos(event.Name)
-					if err != nil {
-						writeLog(logfile, "error getting last 100th line position: "+err.Error())
-						continue
-					}
-					file.Seek(lastPos, 0)
-					reader := io.Reader(file)
-					contents, err := io.ReadAll(reader)
-					if err != nil {
-						writeLog(logfile, "error reading file: "+err.Error())
-					} else {
-						lines := strings.Split(string(contents), "\n")
-						for _, line := range lines {
-							lineLower := strings.ToLower(line)
-							if strings.Contains(lineLower, "error") || strings.Contains(lineLower, "fail") || strings.Contains(lineLower, "exception") {
-								fmt.Println(filePath + ": " + line)
-							}
-						}
-						lastPos, _ = file.Seek(0, io.SeekEnd)
-					}
-					file.Close()
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				writeLog(logfile, "error: "+err.Error())
-			}
-		}
-	}()
-
-	err = watcher.Add(filePath)
-	if err != nil {
-		return err
-	}
-	<-done
-	return nil
-}
-
-func monitorLogs() {
-	dir := "logs"
-	_, err := ioutil.ReadDir(dir)
-	if err != nil {
-		fmt.Println("Error reading directory:", err)
-		return
-	}
-
-	type FileInfo struct {
-		Path    string
-		ModTime time.Time
-	}
-
-	var logFiles []FileInfo
-
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Ignore directories
-		if !info.IsDir() {
-			logFiles = append(logFiles, FileInfo{Path: path, ModTime: info.ModTime()})
-		}
-
-		return nil
-	})
-
-	// Sort the files by modification time
-	sort.Slice(logFiles, func(i, j int) bool {
-		return logFiles[i].ModTime.Before(logFiles[j].ModTime)
-	})
-
-	// If there are more than 10 files, take the last 10
-	if len(logFiles) > 10 {
-		logFiles = logFiles[len(logFiles)-10:]
-	}
-
-	// Automatically watch the 10 latest files
-	for _, file := range logFiles {
-		go func(filePath string) {
-			err := watchFile(filePath, logfile)
-			if err != nil {
-				fmt.Println("Error watching file:", err)
-			}
-		}(file.Path)
-	}
-
-	// Only block if at least one watchFile goroutine was started
-	if len(logFiles) > 0 {
-		// Prevent the program from exiting
-		select {}
-	}
+	return lines[0], count - len(lines) + 1, nil
 }
 
 func mustParseInt(s string) int {
@@ -377,31 +430,6 @@ func tailFile(filename string) {
 	}
 }
 
-func executeAndTime(script string, times int, pacingTime int) {
-	for i := 1; i <= times; i++ {
-		start := time.Now()
-		message := fmt.Sprintf("Starting %s run %d at %s\n", script, i, start)
-		writeLog(logfile, message)
-
-		cmd := exec.Command("bash", script)
-		err := cmd.Run()
-		if err != nil {
-			message := fmt.Sprintf("%s failed with exit status %v\n", script, err)
-			writeLog(logfile, message)
-			break
-		}
-
-		end := time.Now()
-		duration := end.Sub(start)
-		message = fmt.Sprintf("Execution time for %s run %d: %v seconds\n", script, i, duration.Seconds())
-		writeLog(logfile, message)
-		message = fmt.Sprintf("Ended %s run %d at %s\n", script, i, end)
-		writeLog(logfile, message)
-
-		time.Sleep(time.Duration(pacingTime) * time.Second)
-	}
-}
-
 func getStack(coreFile string) ([]byte, error) {
 	cmd := exec.Command("./pmx", "-e", coreFile)
 	return cmd.Output()
@@ -439,13 +467,22 @@ func writeStackToFile(coreFile string) error {
 	return nil
 }
 
+// findLogFiles returns the files under logs whose path contains pid. The
+// .gz extension and rotation suffix of a rotated log are left out of the
+// match, so that app_1530.log.2.gz goes with the logs of process 1530 but
+// app.log.2 does not go with those of process 2, unless the whole suffix is
+// the pid.
 func findLogFiles(pid string) ([]string, error) {
 	var logFiles []string
 	err := filepath.Walk("logs", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() && strings.Contains(path, pid) {
+		if info.IsDir() {
+			return nil
+		}
+		name := strings.TrimSuffix(path, ".gz")
+		if strings.Contains(trimArchiveSuffix(path), pid) || strings.HasSuffix(name, "."+pid) {
 			logFiles = append(logFiles, path)
 		}
 		return nil
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain sends the log of the tests to a temporary directory, where the
+// summary files written next to it also go.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "pac_weiyu_test")
+	if err != nil {
+		panic(err)
+	}
+	logfile.Close()
+	logfile, err = os.Create(filepath.Join(dir, "pac_weiyu.log"))
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	logfile.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
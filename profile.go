@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stagePollInterval is how often an idle worker checks whether the current
+// stage of a load profile needs it.
+const stagePollInterval = 100 * time.Millisecond
+
+// stage is a step of a load profile: workers virtual users are active for
+// duration.
+type stage struct {
+	duration time.Duration
+	workers  int
+}
+
+// thinkTime is a randomized delay added to the pacing between two runs of a
+// worker.
+type thinkTime struct {
+	distribution string
+	min          time.Duration
+	max          time.Duration
+	mean         time.Duration
+}
+
+// parsePacing parses a pacing given either as a number of seconds, which may
+// be fractional, or as a Go duration such as "500ms".
+func parsePacing(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("invalid pacing: %s", s)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid pacing: %s", s)
+	}
+	return d, nil
+}
+
+// parseStages parses a comma separated list of <duration>:<workers> stages,
+// for example "30s:2,5m:10,30s:0".
+func parseStages(s string) ([]stage, error) {
+	var stages []stage
+	for _, field := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid stage %q, expected <duration>:<workers>", field)
+		}
+		duration, err := time.ParseDuration(parts[0])
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid stage duration %q", parts[0])
+		}
+		workers, err := strconv.Atoi(parts[1])
+		if err != nil || workers < 0 {
+			return nil, fmt.Errorf("invalid stage workers %q", parts[1])
+		}
+		stages = append(stages, stage{duration: duration, workers: workers})
+	}
+	return stages, nil
+}
+
+// stageWorkers returns the number of workers wanted elapsed after the start of
+// the profile, and false once the last stage is over.
+func stageWorkers(stages []stage, elapsed time.Duration) (int, bool) {
+	for _, st := range stages {
+		if elapsed < st.duration {
+			return st.workers, true
+		}
+		elapsed -= st.duration
+	}
+	return 0, false
+}
+
+// stagesDuration returns the total duration of a load profile.
+func stagesDuration(stages []stage) time.Duration {
+	var total time.Duration
+	for _, st := range stages {
+		total += st.duration
+	}
+	return total
+}
+
+// maxStageWorkers returns the largest number of workers of any stage, at
+// least one so that a profile made of idle stages still runs until its end.
+func maxStageWorkers(stages []stage) int {
+	max := 1
+	for _, st := range stages {
+		if st.workers > max {
+			max = st.workers
+		}
+	}
+	return max
+}
+
+// parseThinkTime parses "uniform:<min>-<max>" or "exponential:<mean>".
+func parseThinkTime(s string) (thinkTime, error) {
+	distribution, params, ok := strings.Cut(s, ":")
+	if !ok {
+		return thinkTime{}, fmt.Errorf("invalid think time %q", s)
+	}
+
+	t := thinkTime{distribution: distribution}
+	switch distribution {
+	case "uniform":
+		lower, upper, ok := strings.Cut(params, "-")
+		if !ok {
+			return t, fmt.Errorf("invalid uniform think time %q, expected uniform:<min>-<max>", s)
+		}
+		var err error
+		if t.min, err = time.ParseDuration(lower); err != nil {
+			return t, err
+		}
+		if t.max, err = time.ParseDuration(upper); err != nil {
+			return t, err
+		}
+		if t.min < 0 || t.max < t.min {
+			return t, fmt.Errorf("invalid uniform think time %q", s)
+		}
+	case "exponential":
+		var err error
+		if t.mean, err = time.ParseDuration(params); err != nil {
+			return t, err
+		}
+		if t.mean < 0 {
+			return t, fmt.Errorf("invalid exponential think time %q", s)
+		}
+	default:
+		return t, fmt.Errorf("unknown think time distribution %q", distribution)
+	}
+	return t, nil
+}
+
+// sample draws a think time.
+func (t thinkTime) sample(r *rand.Rand) time.Duration {
+	switch t.distribution {
+	case "uniform":
+		return t.min + time.Duration(r.Int63n(int64(t.max-t.min)+1))
+	case "exponential":
+		return time.Duration(r.ExpFloat64() * float64(t.mean))
+	}
+	return 0
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParsePacing(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"2", 2 * time.Second, false},
+		{"0.5", 500 * time.Millisecond, false},
+		{"0", 0, false},
+		{"250ms", 250 * time.Millisecond, false},
+		{"1m30s", 90 * time.Second, false},
+		{"-1", 0, true},
+		{"-5s", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePacing(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parsePacing(%q) = %v, %v, want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseStages(t *testing.T) {
+	tests := []struct {
+		in         string
+		want       []stage
+		maxWorkers int
+		wantErr    bool
+	}{
+		{"30s:2,5m:10,30s:0", []stage{{30 * time.Second, 2}, {5 * time.Minute, 10}, {30 * time.Second, 0}}, 10, false},
+		{" 1m:3 , 10s:1", []stage{{time.Minute, 3}, {10 * time.Second, 1}}, 3, false},
+		{"10s:0,20s:0", []stage{{10 * time.Second, 0}, {20 * time.Second, 0}}, 1, false},
+		{"30s", nil, 0, true},
+		{"30s:2:1", nil, 0, true},
+		{"0s:2", nil, 0, true},
+		{"-1s:2", nil, 0, true},
+		{"30s:-1", nil, 0, true},
+		{"30s:many", nil, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseStages(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStages(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseStages(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("parseStages(%q) = %v, want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+		if max := maxStageWorkers(got); max != tt.maxWorkers {
+			t.Errorf("maxStageWorkers(%q) = %d, want %d", tt.in, max, tt.maxWorkers)
+		}
+	}
+}
+
+func TestStageWorkers(t *testing.T) {
+	stages := []stage{{10 * time.Second, 2}, {20 * time.Second, 0}, {10 * time.Second, 5}}
+	tests := []struct {
+		elapsed time.Duration
+		want    int
+		ok      bool
+	}{
+		{0, 2, true},
+		{9 * time.Second, 2, true},
+		{10 * time.Second, 0, true},
+		{35 * time.Second, 5, true},
+		{40 * time.Second, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := stageWorkers(stages, tt.elapsed)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("stageWorkers(%v) = %d, %v, want %d, %v", tt.elapsed, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseThinkTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    thinkTime
+		wantErr bool
+	}{
+		{"uniform:1s-3s", thinkTime{distribution: "uniform", min: time.Second, max: 3 * time.Second}, false},
+		{"uniform:0s-0s", thinkTime{distribution: "uniform"}, false},
+		{"exponential:500ms", thinkTime{distribution: "exponential", mean: 500 * time.Millisecond}, false},
+		{"uniform:3s-1s", thinkTime{}, true},
+		{"uniform:1s", thinkTime{}, true},
+		{"uniform:-1s-1s", thinkTime{}, true},
+		{"exponential:-1s", thinkTime{}, true},
+		{"exponential:often", thinkTime{}, true},
+		{"normal:1s", thinkTime{}, true},
+		{"1s", thinkTime{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseThinkTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseThinkTime(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseThinkTime(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestThinkTimeSample(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	uniform := thinkTime{distribution: "uniform", min: time.Second, max: 2 * time.Second}
+	for i := 0; i < 1000; i++ {
+		if d := uniform.sample(r); d < uniform.min || d > uniform.max {
+			t.Fatalf("uniform sample %v outside [%v, %v]", d, uniform.min, uniform.max)
+		}
+	}
+	exponential := thinkTime{distribution: "exponential", mean: time.Second}
+	var sum time.Duration
+	for i := 0; i < 10000; i++ {
+		sum += exponential.sample(r)
+	}
+	if mean := sum / 10000; mean < 900*time.Millisecond || mean > 1100*time.Millisecond {
+		t.Errorf("exponential mean = %v, want about %v", mean, exponential.mean)
+	}
+}
+
+func TestSeriesSleepStopsAtDeadline(t *testing.T) {
+	tests := []struct {
+		name string
+		opts executeOptions
+	}{
+		{"duration", executeOptions{duration: 50 * time.Millisecond}},
+		{"stages", executeOptions{stages: []stage{{20 * time.Millisecond, 1}, {30 * time.Millisecond, 0}}}},
+	}
+	for _, tt := range tests {
+		s := &series{start: time.Now(), opts: tt.opts, ctx: context.Background()}
+		s.sleep(time.Minute)
+		if elapsed := time.Since(s.start); elapsed > 5*time.Second {
+			t.Errorf("%s: sleep overshot the end of the series by %v", tt.name, elapsed)
+		}
+	}
+}
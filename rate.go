@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func parseRateOptions(args []string) (executeOptions, error) {
+	opts := executeOptions{workers: 1}
+	fs := flag.NewFlagSet("executeAtRate", flag.ContinueOnError)
+	addRunFlags(fs, &opts)
+	fs.IntVar(&opts.maxInFlight, "max-inflight", 10, "maximum number of runs in flight, further arrivals are dropped")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.maxInFlight < 1 {
+		return opts, fmt.Errorf("invalid maximum of runs in flight: %d", opts.maxInFlight)
+	}
+	return opts, validateRunOptions(opts)
+}
+
+// arrivalInterval returns the time between two arrivals at rate runs per
+// second, checking that rate and duration allow a series.
+func arrivalInterval(rate float64, duration time.Duration) (time.Duration, error) {
+	if !(rate > 0) {
+		return 0, errors.New("rate must be positive")
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	if interval < 1 {
+		return 0, fmt.Errorf("rate %g is too high, at most %d runs per second", rate, int64(time.Second))
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid duration: %v", duration)
+	}
+	return interval, nil
+}
+
+// executeAtRate starts runs of script at rate runs per second for duration,
+// whatever the duration of the earlier runs. An arrival is dropped when
+// opts.maxInFlight runs are already in flight.
+func executeAtRate(script string, rate float64, duration time.Duration, opts executeOptions) (err error) {
+	interval, err := arrivalInterval(rate, duration)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(opts.outputDir, 0755); err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to create %s: %v\n", opts.outputDir, err))
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		resultMu sync.Mutex
+		results  []runResult
+		stopped  atomic.Bool
+		inFlight = make(chan struct{}, opts.maxInFlight)
+		started  int
+		dropped  int
+		peak     int
+	)
+
+	otelShutdown, err := enableExecutionMetrics(&opts)
+	if err != nil {
+		return fmt.Errorf("failed to set up OpenTelemetry: %v", err)
+	}
+	defer func() {
+		err = errors.Join(err, otelShutdown(context.Background()))
+	}()
+
+	sc := singleScriptScenario(script)
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+
+arrivals:
+	for run := 1; ; run++ {
+		if stopped.Load() {
+			break
+		}
+		select {
+		case inFlight <- struct{}{}:
+			started++
+			if len(inFlight) > peak {
+				peak = len(inFlight)
+			}
+			wg.Add(1)
+			go func(run int) {
+				defer wg.Done()
+				defer func() { <-inFlight }()
+				result := executeRun(context.Background(), &sc.Scripts[0], 0, run, opts)
+				if result.err != nil && failurePolicy(result, opts) != "continue" {
+					stopped.Store(true)
+				}
+				resultMu.Lock()
+				results = append(results, result)
+				resultMu.Unlock()
+			}(run)
+		default:
+			dropped++
+			writeLog(logfile, fmt.Sprintf("Dropped %s run %d: %d runs in flight\n", script, run, opts.maxInFlight))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			break arrivals
+		}
+	}
+	wg.Wait()
+
+	message := fmt.Sprintf("Arrival rate summary for %s: target %v runs per second, %d started, %d dropped, peak %d runs in flight\n",
+		script, rate, started, dropped, peak)
+	writeLog(logfile, message)
+	fmt.Print(message)
+	stats := writeSeriesSummary(sc, opts, time.Since(start), [][]runResult{results})
+	logStoredSeries(sc, opts, start, [][]runResult{results})
+	return checkAssertions(opts.assertions, stats)
+}
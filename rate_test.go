@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestArrivalInterval(t *testing.T) {
+	tests := []struct {
+		rate     float64
+		duration time.Duration
+		want     time.Duration
+		wantErr  bool
+	}{
+		{2, time.Minute, 500 * time.Millisecond, false},
+		{0.5, time.Minute, 2 * time.Second, false},
+		{1e9, time.Second, 1, false},
+		{2e9, time.Second, 0, true},
+		{math.Inf(1), time.Second, 0, true},
+		{math.NaN(), time.Second, 0, true},
+		{0, time.Second, 0, true},
+		{-1, time.Second, 0, true},
+		{1, 0, 0, true},
+		{1, -time.Second, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := arrivalInterval(tt.rate, tt.duration)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("arrivalInterval(%v, %v) = %v, %v, want %v, error %v", tt.rate, tt.duration, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
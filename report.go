@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	chartWidth   = 720
+	chartHeight  = 240
+	chartPadding = 40
+)
+
+// Lines written by executeAndTime. A run label is "run N" or "worker W run N",
+// optionally followed by "attempt A".
+var (
+	startingLine = regexp.MustCompile(`^Starting (.+?) ((?:worker \d+ )?run \d+(?: attempt \d+)?) at (.+)$`)
+	durationLine = regexp.MustCompile(`^Execution time for (.+?) ((?:worker \d+ )?run \d+(?: attempt \d+)?): ([0-9.eE+-]+) seconds$`)
+	endedLine    = regexp.MustCompile(`^Ended (.+?) ((?:worker \d+ )?run \d+(?: attempt \d+)?) at (.+)$`)
+	failedLine   = regexp.MustCompile(`^(.+?) (?:((?:worker \d+ )?run \d+(?: attempt \d+)?) )?(failed with exit status .+|failed: .+|timed out after .+)$`)
+	summaryLine  = regexp.MustCompile(`^Summary for (.+?): `)
+	labelPattern = regexp.MustCompile(`^(?:worker (\d+) )?run (\d+)(?: attempt (\d+))?$`)
+)
+
+// loggedRun is a run of a script read back from pac_weiyu.log. The outcome
+// of a retried run is that of its last attempt.
+type loggedRun struct {
+	label    string
+	worker   int
+	run      int
+	attempts int
+	start    time.Time
+	end      time.Time
+	duration float64
+	failure  string
+	timedOut bool
+}
+
+// loggedSeries is a series of runs of a script read back from pac_weiyu.log.
+type loggedSeries struct {
+	script string
+	runs   []*loggedRun
+	closed bool
+}
+
+// parseRunLog groups the runs logged in path into series, in the order in
+// which the series started. A series ends with its summary line, or when
+// the first run of its first worker starts again.
+func parseRunLog(path string) ([]*loggedSeries, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var all []*loggedSeries
+	current := make(map[string]*loggedSeries)
+	pending := make(map[string]*loggedRun)
+
+	seriesOf := func(script string) *loggedSeries {
+		s := current[script]
+		if s == nil || s.closed {
+			s = &loggedSeries{script: script}
+			current[script] = s
+			all = append(all, s)
+		}
+		return s
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := startingLine.FindStringSubmatch(line); m != nil {
+			run := &loggedRun{label: m[2], attempts: 1, start: parseLogTime(m[3])}
+			attempt := 1
+			if lm := labelPattern.FindStringSubmatch(m[2]); lm != nil {
+				run.worker, _ = strconv.Atoi(lm[1])
+				run.run, _ = strconv.Atoi(lm[2])
+				if lm[3] != "" {
+					attempt, _ = strconv.Atoi(lm[3])
+					run.label = strings.TrimSuffix(m[2], " attempt "+lm[3])
+				}
+			}
+			if attempt > 1 {
+				// A retry replaces the outcome of the earlier attempts.
+				if earlier := current[m[1]].find(run.worker, run.run); earlier != nil {
+					earlier.attempts = attempt
+					earlier.end, earlier.duration, earlier.failure, earlier.timedOut = time.Time{}, 0, "", false
+					pending[m[1]+" "+m[2]] = earlier
+					continue
+				}
+				run.attempts = attempt
+			}
+			if s := current[m[1]]; s != nil && !s.closed && run.run == 1 && run.worker <= 1 && attempt == 1 {
+				for _, r := range s.runs {
+					if r.run == 1 && r.worker <= 1 {
+						s.closed = true
+						break
+					}
+				}
+			}
+			s := seriesOf(m[1])
+			s.runs = append(s.runs, run)
+			pending[m[1]+" "+m[2]] = run
+		} else if m := durationLine.FindStringSubmatch(line); m != nil {
+			if run := pending[m[1]+" "+m[2]]; run != nil {
+				run.duration, _ = strconv.ParseFloat(m[3], 64)
+			}
+		} else if m := endedLine.FindStringSubmatch(line); m != nil {
+			if run := pending[m[1]+" "+m[2]]; run != nil {
+				run.end = parseLogTime(m[3])
+				delete(pending, m[1]+" "+m[2])
+			}
+		} else if m := failedLine.FindStringSubmatch(line); m != nil {
+			run := pending[m[1]+" "+m[2]]
+			if m[2] == "" {
+				// Lines written before runs were labelled only name the script.
+				if s := current[m[1]]; s != nil && len(s.runs) > 0 {
+					run = s.runs[len(s.runs)-1]
+				}
+			}
+			if run != nil {
+				run.failure = m[3]
+				run.timedOut = strings.HasPrefix(m[3], "timed out")
+				delete(pending, m[1]+" "+m[2])
+			}
+		} else if m := summaryLine.FindStringSubmatch(line); m != nil {
+			if s := current[m[1]]; s != nil {
+				s.closed = true
+			}
+		}
+	}
+	return all, scanner.Err()
+}
+
+// find returns the last run of the open series s with the given worker and
+// number, nil if there is none.
+func (s *loggedSeries) find(worker, run int) *loggedRun {
+	if s == nil || s.closed {
+		return nil
+	}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if r := s.runs[i]; r.worker == worker && r.run == run {
+			return r
+		}
+	}
+	return nil
+}
+
+// counts returns the durations of the successful runs of s with the
+// numbers of failed and timed-out runs.
+func (s *loggedSeries) counts() (durations []float64, failed int, timedOut int) {
+	for _, r := range s.runs {
+		switch {
+		case r.timedOut:
+			timedOut++
+		case r.failure != "":
+			failed++
+		case r.duration > 0 || !r.end.IsZero():
+			durations = append(durations, r.duration)
+		}
+	}
+	return durations, failed, timedOut
+}
+
+// parseLogTime parses a time written with time.Time.String, ignoring the
+// monotonic clock reading.
+func parseLogTime(s string) time.Time {
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	t, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// writeRunReport renders the series logged in logPath as an HTML page with
+// SVG charts.
+func writeRunReport(logPath, outPath string) error {
+	all, err := parseRunLog(logPath)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>pac_weiyu run report</title>\n")
+	b.WriteString("<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 8px;text-align:right}svg{display:block;margin:1em 0}</style>\n")
+	fmt.Fprintf(&b, "</head><body>\n<h1>Run report of %s</h1>\n<p>%d series, generated %s</p>\n",
+		html.EscapeString(logPath), len(all), time.Now().Format("2006-01-02 15:04:05"))
+
+	for i, s := range all {
+		durations, failed, timedOut := s.counts()
+		stats := computeStats(s.script, durations, failed, timedOut)
+
+		fmt.Fprintf(&b, "<h2>%d. %s</h2>\n", i+1, html.EscapeString(s.script))
+		if len(s.runs) > 0 && !s.runs[0].start.IsZero() {
+			fmt.Fprintf(&b, "<p>Started %s</p>\n", s.runs[0].start.Format("2006-01-02 15:04:05"))
+		}
+		b.WriteString("<table><tr><th>runs</th><th>failed</th><th>timed out</th><th>min</th><th>mean</th><th>p50</th><th>p90</th><th>p95</th><th>p99</th><th>max</th></tr>\n")
+		fmt.Fprintf(&b, "<tr><td>%d</td><td>%d</td><td>%d</td><td>%.3f</td><td>%.3f</td><td>%.3f</td><td>%.3f</td><td>%.3f</td><td>%.3f</td><td>%.3f</td></tr></table>\n",
+			len(s.runs), failed, timedOut, stats.Min, stats.Mean, stats.P50, stats.P90, stats.P95, stats.P99, stats.Max)
+		b.WriteString(timeSeriesChart(s))
+		b.WriteString(distributionChart(stats))
+
+		var failures []string
+		for _, r := range s.runs {
+			if r.failure != "" {
+				failures = append(failures, fmt.Sprintf("<li>%s: %s</li>", html.EscapeString(r.describe()), html.EscapeString(r.failure)))
+			}
+		}
+		if len(failures) > 0 {
+			fmt.Fprintf(&b, "<ul>%s</ul>\n", strings.Join(failures, ""))
+		}
+	}
+	b.WriteString("</body></html>\n")
+	return os.WriteFile(outPath, []byte(b.String()), 0644)
+}
+
+// describe returns the label of the run with its number of attempts.
+func (r *loggedRun) describe() string {
+	if r.attempts > 1 {
+		return fmt.Sprintf("%s (%d attempts)", r.label, r.attempts)
+	}
+	return r.label
+}
+
+// timeSeriesChart plots the execution time of each run in start order, with
+// failed runs as red marks on the axis and timed-out runs as orange ones.
+func timeSeriesChart(s *loggedSeries) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg width=\"%d\" height=\"%d\" xmlns=\"http://www.w3.org/2000/svg\">\n", chartWidth, chartHeight)
+	fmt.Fprintf(&b, "<text x=\"%d\" y=\"15\" font-size=\"12\">Execution time per run (s)</text>\n", chartPadding)
+	plotW, plotH := float64(chartWidth-2*chartPadding), float64(chartHeight-2*chartPadding)
+	fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%.0f\" height=\"%.0f\" fill=\"none\" stroke=\"#999\"/>\n", chartPadding, chartPadding, plotW, plotH)
+
+	max := 0.0
+	for _, r := range s.runs {
+		if r.duration > max {
+			max = r.duration
+		}
+	}
+	if max == 0 || len(s.runs) == 0 {
+		b.WriteString("</svg>\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "<text x=\"2\" y=\"%d\" font-size=\"10\">%.2f</text>\n", chartPadding+4, max)
+	fmt.Fprintf(&b, "<text x=\"2\" y=\"%d\" font-size=\"10\">0</text>\n", chartHeight-chartPadding)
+
+	step := plotW
+	if len(s.runs) > 1 {
+		step = plotW / float64(len(s.runs)-1)
+	}
+	var points []string
+	for i, r := range s.runs {
+		x := float64(chartPadding) + float64(i)*step
+		if len(s.runs) == 1 {
+			x = float64(chartPadding) + plotW/2
+		}
+		if r.failure != "" {
+			color := "red"
+			if r.timedOut {
+				color = "orange"
+			}
+			fmt.Fprintf(&b, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"3\" fill=\"%s\"><title>%s: %s</title></circle>\n",
+				x, float64(chartPadding)+plotH, color, html.EscapeString(r.describe()), html.EscapeString(r.failure))
+			continue
+		}
+		y := float64(chartPadding) + plotH - r.duration/max*plotH
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		fmt.Fprintf(&b, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"2\" fill=\"steelblue\"><title>%s: %.3fs</title></circle>\n",
+			x, y, html.EscapeString(r.describe()), r.duration)
+	}
+	fmt.Fprintf(&b, "<polyline points=\"%s\" fill=\"none\" stroke=\"steelblue\"/>\n", strings.Join(points, " "))
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// distributionChart draws the histogram of the execution times.
+func distributionChart(stats seriesStats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg width=\"%d\" height=\"%d\" xmlns=\"http://www.w3.org/2000/svg\">\n", chartWidth, chartHeight)
+	fmt.Fprintf(&b, "<text x=\"%d\" y=\"15\" font-size=\"12\">Distribution of execution times (s)</text>\n", chartPadding)
+	if len(stats.Histogram) == 0 {
+		b.WriteString("</svg>\n")
+		return b.String()
+	}
+
+	plotW, plotH := float64(chartWidth-2*chartPadding), float64(chartHeight-2*chartPadding)
+	largest := 0
+	for _, bucket := range stats.Histogram {
+		if bucket.Count > largest {
+			largest = bucket.Count
+		}
+	}
+	barW := plotW / float64(len(stats.Histogram))
+	for i, bucket := range stats.Histogram {
+		h := float64(bucket.Count) / float64(largest) * plotH
+		x := float64(chartPadding) + float64(i)*barW
+		fmt.Fprintf(&b, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"steelblue\" stroke=\"white\"><title>%.3f-%.3fs: %d</title></rect>\n",
+			x, float64(chartPadding)+plotH-h, barW, h, bucket.Lower, bucket.Upper, bucket.Count)
+		fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%d\" font-size=\"10\">%.2f</text>\n", x, chartHeight-chartPadding+14, bucket.Lower)
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sampleRunLog is a series of three runs: the first succeeds, the second
+// fails once and succeeds on retry, the third times out twice.
+const sampleRunLog = `Starting run.sh run 1 at 2024-05-01 12:00:00.000000000 +0000 UTC m=+0.001
+Execution time for run.sh run 1: 1.5 seconds
+Resources for run.sh run 1: peak RSS 1.0 MB
+Ended run.sh run 1 at 2024-05-01 12:00:01.500000000 +0000 UTC m=+1.501
+Starting run.sh run 2 at 2024-05-01 12:00:02.000000000 +0000 UTC m=+2.001
+run.sh run 2 failed with exit status 1
+Resources for run.sh run 2: peak RSS 1.0 MB
+Retrying run.sh run 2 in 1 seconds
+Starting run.sh run 2 attempt 2 at 2024-05-01 12:00:03.000000000 +0000 UTC m=+3.001
+Execution time for run.sh run 2 attempt 2: 2.5 seconds
+Ended run.sh run 2 attempt 2 at 2024-05-01 12:00:05.500000000 +0000 UTC m=+5.501
+Starting run.sh run 3 at 2024-05-01 12:00:06.000000000 +0000 UTC m=+6.001
+run.sh run 3 timed out after 5 seconds
+Retrying run.sh run 3 in 1 seconds
+Starting run.sh run 3 attempt 2 at 2024-05-01 12:00:12.000000000 +0000 UTC m=+12.001
+run.sh run 3 attempt 2 timed out after 5 seconds
+Summary for run.sh: 3 runs
+Starting run.sh run 1 at 2024-05-01 13:00:00.000000000 +0000 UTC m=+0.001
+run.sh run 1 failed with exit status 2
+Starting run.sh run 1 attempt 2 at 2024-05-01 13:00:01.000000000 +0000 UTC m=+1.001
+run.sh run 1 attempt 2 failed with exit status 3
+`
+
+func TestParseRunLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pac_weiyu.log")
+	if err := os.WriteFile(path, []byte(sampleRunLog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	all, err := parseRunLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("parseRunLog() returned %d series, want 2", len(all))
+	}
+
+	tests := []struct {
+		series   int
+		run      int
+		label    string
+		attempts int
+		duration float64
+		failure  string
+		timedOut bool
+	}{
+		{0, 0, "run 1", 1, 1.5, "", false},
+		{0, 1, "run 2", 2, 2.5, "", false},
+		{0, 2, "run 3", 2, 0, "timed out after 5 seconds", true},
+		{1, 0, "run 1", 2, 0, "failed with exit status 3", false},
+	}
+	for _, tt := range tests {
+		runs := all[tt.series].runs
+		if tt.run >= len(runs) {
+			t.Errorf("series %d has %d runs, want more than %d", tt.series, len(runs), tt.run)
+			continue
+		}
+		r := runs[tt.run]
+		if r.label != tt.label || r.attempts != tt.attempts || r.duration != tt.duration || r.failure != tt.failure || r.timedOut != tt.timedOut {
+			t.Errorf("series %d run %d = %+v, want label %q, %d attempts, duration %v, failure %q, timed out %v",
+				tt.series, tt.run, *r, tt.label, tt.attempts, tt.duration, tt.failure, tt.timedOut)
+		}
+	}
+	for i, want := range []int{3, 1} {
+		if got := len(all[i].runs); got != want {
+			t.Errorf("series %d has %d runs, want %d", i, got, want)
+		}
+	}
+
+	durations, failed, timedOut := all[0].counts()
+	if len(durations) != 2 || failed != 0 || timedOut != 1 {
+		t.Errorf("counts() = %v, %d, %d, want 2 durations, 0 failed, 1 timed out", durations, failed, timedOut)
+	}
+}
+
+func TestWriteRunReport(t *testing.T) {
+	dir := t.TempDir()
+	logPath, outPath := filepath.Join(dir, "pac_weiyu.log"), filepath.Join(dir, "report.html")
+	if err := os.WriteFile(logPath, []byte(sampleRunLog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeRunReport(logPath, outPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+	for _, want := range []string{
+		"<th>timed out</th>",
+		"<tr><td>3</td><td>0</td><td>1</td>",
+		"<tr><td>1</td><td>1</td><td>0</td>",
+		"run 3 (2 attempts): timed out after 5 seconds",
+		"fill=\"orange\"",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// resourceUsage is what a run and the processes it started consumed.
+type resourceUsage struct {
+	PeakRSS                int64         `json:"peak_rss_bytes"`
+	UserCPU                time.Duration `json:"user_cpu_ns"`
+	SystemCPU              time.Duration `json:"system_cpu_ns"`
+	VoluntaryCtxSwitches   int64         `json:"voluntary_ctx_switches"`
+	InvoluntaryCtxSwitches int64         `json:"involuntary_ctx_switches"`
+	ReadBytes              int64         `json:"read_bytes"`
+	WriteBytes             int64         `json:"write_bytes"`
+}
+
+// resourceStats averages the resource usage of the successful runs of a
+// series. CPUShare is the CPU time of the runs divided by their duration,
+// close to 1 or above for CPU-bound runs.
+type resourceStats struct {
+	MeanPeakRSS                float64 `json:"mean_peak_rss_bytes"`
+	MaxPeakRSS                 int64   `json:"max_peak_rss_bytes"`
+	MeanUserCPU                float64 `json:"mean_user_cpu"`
+	MeanSystemCPU              float64 `json:"mean_system_cpu"`
+	MeanVoluntaryCtxSwitches   float64 `json:"mean_voluntary_ctx_switches"`
+	MeanInvoluntaryCtxSwitches float64 `json:"mean_involuntary_ctx_switches"`
+	MeanReadBytes              float64 `json:"mean_read_bytes"`
+	MeanWriteBytes             float64 `json:"mean_write_bytes"`
+	CPUShare                   float64 `json:"cpu_share"`
+}
+
+// treeSampler samples the memory and I/O of the processes of a run while it
+// executes: the script, which leads its own process group, and all its
+// descendants.
+type treeSampler struct {
+	pid      int
+	peakRSS  int64
+	ioByPID  map[int][2]int64
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+func startTreeSampler(pid int, interval time.Duration) *treeSampler {
+	s := &treeSampler{pid: pid, ioByPID: make(map[int][2]int64), stop: make(chan struct{}), finished: make(chan struct{})}
+	go func() {
+		defer close(s.finished)
+		if interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.sample()
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// sample adds up the RSS of the processes of the run and remembers the I/O
+// counters of each of them.
+func (s *treeSampler) sample() {
+	pids, ok := processTree(s.pid)
+	if !ok {
+		pids = processGroup(s.pid)
+	}
+	var rss int64
+	for _, pid := range pids {
+		fields, err := readProcStat(pid)
+		if err != nil || len(fields) < 22 {
+			continue
+		}
+		pages, _ := strconv.ParseInt(fields[21], 10, 64)
+		rss += pages * int64(os.Getpagesize())
+
+		if read, written, err := readProcIO(pid); err == nil {
+			s.ioByPID[pid] = [2]int64{read, written}
+		}
+	}
+	if rss > s.peakRSS {
+		s.peakRSS = rss
+	}
+}
+
+// processTree returns pid and its descendants, walking down the children
+// listed by the kernel for each thread. It returns false when the kernel
+// does not list the children of processes.
+func processTree(pid int) ([]int, bool) {
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		children, err := filepath.Glob(fmt.Sprintf("/proc/%d/task/*/children", pids[i]))
+		if err != nil {
+			continue
+		}
+		if len(children) == 0 && i == 0 {
+			if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err == nil {
+				return nil, false
+			}
+		}
+		for _, path := range children {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			for _, field := range strings.Fields(string(data)) {
+				if child, err := strconv.Atoi(field); err == nil {
+					pids = append(pids, child)
+				}
+			}
+		}
+	}
+	return pids, true
+}
+
+// processGroup returns the processes of the group pgid by scanning /proc,
+// for the kernels that do not list the children of processes.
+func processGroup(pgid int) []int {
+	statFiles, _ := filepath.Glob("/proc/[0-9]*/stat")
+	var pids []int
+	for _, statFile := range statFiles {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(statFile)))
+		if err != nil {
+			continue
+		}
+		fields, err := readProcStat(pid)
+		if err != nil || len(fields) < 3 || mustParseInt(fields[2]) != pgid {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// readProcStat returns the fields of /proc/<pid>/stat following the command
+// name, starting with the state.
+func readProcStat(pid int) ([]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// The command name in parentheses may contain spaces.
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return nil, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+	return strings.Fields(string(data[end+1:])), nil
+}
+
+// finish stops the sampling and combines it with the rusage of the exited
+// run, which accounts for the CPU time and context switches of the script
+// and of the descendants it waited for.
+func (s *treeSampler) finish(cmd *exec.Cmd) resourceUsage {
+	close(s.stop)
+	<-s.finished
+
+	usage := resourceUsage{PeakRSS: s.peakRSS}
+	for _, io := range s.ioByPID {
+		usage.ReadBytes += io[0]
+		usage.WriteBytes += io[1]
+	}
+	if cmd.ProcessState == nil {
+		return usage
+	}
+	if ru, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+		usage.UserCPU = time.Duration(ru.Utime.Nano())
+		usage.SystemCPU = time.Duration(ru.Stime.Nano())
+		usage.VoluntaryCtxSwitches = ru.Nvcsw
+		usage.InvoluntaryCtxSwitches = ru.Nivcsw
+		if maxRSS := ru.Maxrss * 1024; maxRSS > usage.PeakRSS {
+			usage.PeakRSS = maxRSS
+		}
+		// Block counts are in 512-byte units.
+		if blocks := ru.Inblock * 512; blocks > usage.ReadBytes {
+			usage.ReadBytes = blocks
+		}
+		if blocks := ru.Oublock * 512; blocks > usage.WriteBytes {
+			usage.WriteBytes = blocks
+		}
+	}
+	return usage
+}
+
+// readProcIO returns the bytes read from and written to storage by a process.
+func readProcIO(pid int) (int64, int64, error) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var read, written int64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "read_bytes":
+			read, _ = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		case "write_bytes":
+			written, _ = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	return read, written, scanner.Err()
+}
+
+// formatUsage renders usage for pac_weiyu.log.
+func formatUsage(usage resourceUsage) string {
+	return fmt.Sprintf("peak RSS %.1f MB, user CPU %.3f seconds, system CPU %.3f seconds, %d voluntary and %d involuntary context switches, read %d bytes, written %d bytes",
+		float64(usage.PeakRSS)/(1024*1024), usage.UserCPU.Seconds(), usage.SystemCPU.Seconds(),
+		usage.VoluntaryCtxSwitches, usage.InvoluntaryCtxSwitches, usage.ReadBytes, usage.WriteBytes)
+}
+
+// computeResourceStats averages the resource usage of the successful results.
+func computeResourceStats(results []runResult) *resourceStats {
+	var stats resourceStats
+	var n float64
+	var cpu, elapsed time.Duration
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		n++
+		u := r.usage
+		stats.MeanPeakRSS += float64(u.PeakRSS)
+		if u.PeakRSS > stats.MaxPeakRSS {
+			stats.MaxPeakRSS = u.PeakRSS
+		}
+		stats.MeanUserCPU += u.UserCPU.Seconds()
+		stats.MeanSystemCPU += u.SystemCPU.Seconds()
+		stats.MeanVoluntaryCtxSwitches += float64(u.VoluntaryCtxSwitches)
+		stats.MeanInvoluntaryCtxSwitches += float64(u.InvoluntaryCtxSwitches)
+		stats.MeanReadBytes += float64(u.ReadBytes)
+		stats.MeanWriteBytes += float64(u.WriteBytes)
+		cpu += u.UserCPU + u.SystemCPU
+		elapsed += r.duration()
+	}
+	if n == 0 {
+		return nil
+	}
+	stats.MeanPeakRSS /= n
+	stats.MeanUserCPU /= n
+	stats.MeanSystemCPU /= n
+	stats.MeanVoluntaryCtxSwitches /= n
+	stats.MeanInvoluntaryCtxSwitches /= n
+	stats.MeanReadBytes /= n
+	stats.MeanWriteBytes /= n
+	if elapsed > 0 {
+		stats.CPUShare = cpu.Seconds() / elapsed.Seconds()
+	}
+	return &stats
+}
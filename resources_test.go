@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTreeSamplerFindsDescendants(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 5 & sleep 5 & wait")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+	}()
+
+	// Wait for the shell to start both sleeps.
+	var group []int
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if group = processGroup(cmd.Process.Pid); len(group) == 3 {
+			break
+		}
+	}
+	if len(group) != 3 {
+		t.Fatalf("processGroup() = %v, want the shell and its 2 children", group)
+	}
+	if tree, ok := processTree(cmd.Process.Pid); ok && len(tree) != 3 {
+		t.Errorf("processTree() = %v, want the shell and its 2 children", tree)
+	}
+
+	s := &treeSampler{pid: cmd.Process.Pid, ioByPID: make(map[int][2]int64)}
+	s.sample()
+	if s.peakRSS <= 0 {
+		t.Errorf("sample() peak RSS = %d, want positive", s.peakRSS)
+	}
+}
+
+func TestReadProcStat(t *testing.T) {
+	fields, err := readProcStat(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) < 22 || fields[0] != "R" && fields[0] != "S" {
+		t.Errorf("readProcStat() = %v, want the fields after the command name", fields)
+	}
+	if _, err := readProcStat(-1); err == nil {
+		t.Error("readProcStat(-1) succeeded")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// significanceLevel is the p-value below which compareSeries reports a
+// significant difference.
+const significanceLevel = 0.05
+
+// seriesRecord is the stored result of a series.
+type seriesRecord struct {
+	ID        string            `json:"id"`
+	Script    string            `json:"script"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	Durations []float64         `json:"durations"`
+	Failed    int               `json:"failed"`
+	TimedOut  int               `json:"timed_out"`
+}
+
+// storeSeries saves the results of a series in the results directory and
+// returns its ID.
+func storeSeries(sc *scenario, opts executeOptions, start time.Time, results [][]runResult) (string, error) {
+	record := seriesRecord{Script: sc.Name, Labels: opts.labels, Start: start, End: time.Now()}
+	for _, workerResults := range results {
+		for _, r := range workerResults {
+			switch {
+			case r.timedOut:
+				record.TimedOut++
+			case r.err != nil:
+				record.Failed++
+			default:
+				record.Durations = append(record.Durations, r.duration().Seconds())
+			}
+		}
+	}
+
+	if err := os.MkdirAll(opts.resultsDir, 0755); err != nil {
+		return "", err
+	}
+	base := fmt.Sprintf("%s_%s", strings.TrimSuffix(filepath.Base(sc.Name), filepath.Ext(sc.Name)), start.Format("20060102_150405"))
+	record.ID = base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(opts.resultsDir, record.ID+".json")); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		record.ID = fmt.Sprintf("%s_%d", base, i)
+	}
+	return record.ID, writeRecord(filepath.Join(opts.resultsDir, record.ID+".json"), record)
+}
+
+func writeRecord(path string, record seriesRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func readRecord(path string) (seriesRecord, error) {
+	var record seriesRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return record, nil
+}
+
+// saveBaseline stores the series seriesID as the baseline called name.
+func saveBaseline(resultsDir, seriesID, name string) error {
+	record, err := readRecord(filepath.Join(resultsDir, seriesID+".json"))
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(resultsDir, "baselines")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeRecord(filepath.Join(dir, name+".json"), record)
+}
+
+// latestSeries returns the most recent stored series of script.
+func latestSeries(resultsDir, script string) (seriesRecord, error) {
+	paths, err := filepath.Glob(filepath.Join(resultsDir, "*.json"))
+	if err != nil {
+		return seriesRecord{}, err
+	}
+
+	var latest seriesRecord
+	found := false
+	for _, path := range paths {
+		record, err := readRecord(path)
+		if err != nil {
+			return seriesRecord{}, err
+		}
+		if record.Script == script && (!found || record.Start.After(latest.Start)) {
+			latest = record
+			found = true
+		}
+	}
+	if !found {
+		return latest, fmt.Errorf("no stored series of %s in %s", script, resultsDir)
+	}
+	return latest, nil
+}
+
+// compareSeries compares a series, by default the latest one of the same
+// script, with the baseline called name using a two-sided Mann-Whitney U
+// test. It returns an error when the series is significantly slower.
+func compareSeries(resultsDir, name, seriesID string) error {
+	baseline, err := readRecord(filepath.Join(resultsDir, "baselines", name+".json"))
+	if err != nil {
+		return err
+	}
+	var current seriesRecord
+	if seriesID != "" {
+		current, err = readRecord(filepath.Join(resultsDir, seriesID+".json"))
+	} else {
+		current, err = latestSeries(resultsDir, baseline.Script)
+	}
+	if err != nil {
+		return err
+	}
+	if len(baseline.Durations) == 0 || len(current.Durations) == 0 {
+		return errors.New("both series need successful runs to be compared")
+	}
+
+	u, z, p := mannWhitney(baseline.Durations, current.Durations)
+	baseMedian := percentile(sortedCopy(baseline.Durations), 50)
+	currentMedian := percentile(sortedCopy(current.Durations), 50)
+	change := (currentMedian - baseMedian) / baseMedian * 100
+
+	fmt.Printf("Baseline %s: series %s %s, %d runs, median %.3fs\n", name, baseline.ID, formatLabels(baseline.Labels), len(baseline.Durations), baseMedian)
+	fmt.Printf("Current:  series %s %s, %d runs, median %.3fs\n", current.ID, formatLabels(current.Labels), len(current.Durations), currentMedian)
+	fmt.Printf("Median change %+.1f%%, Mann-Whitney U=%.1f z=%.3f p=%.4f\n", change, u, z, p)
+
+	message := fmt.Sprintf("Comparison of %s with baseline %s: median change %+.1f%%, p=%.4f", current.ID, name, change, p)
+	switch {
+	case p >= significanceLevel:
+		fmt.Printf("No significant difference at the %.2f level\n", significanceLevel)
+		writeLog(logfile, message+", not significant\n")
+	case currentMedian > baseMedian:
+		fmt.Printf("Significant regression at the %.2f level\n", significanceLevel)
+		writeLog(logfile, message+", significant regression\n")
+		return fmt.Errorf("series %s is significantly slower than baseline %s", current.ID, name)
+	default:
+		fmt.Printf("Significant improvement at the %.2f level\n", significanceLevel)
+		writeLog(logfile, message+", significant improvement\n")
+	}
+	return nil
+}
+
+// mannWhitney returns the U statistic of b against a, with the z score and
+// the two-sided p-value of the normal approximation corrected for ties.
+func mannWhitney(a, b []float64) (u, z, p float64) {
+	type sample struct {
+		value float64
+		fromB bool
+	}
+	samples := make([]sample, 0, len(a)+len(b))
+	for _, v := range a {
+		samples = append(samples, sample{value: v})
+	}
+	for _, v := range b {
+		samples = append(samples, sample{value: v, fromB: true})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+
+	// Rank the samples, giving tied values their average rank.
+	var rankSumB, tieTerm float64
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if samples[k].fromB {
+				rankSumB += rank
+			}
+		}
+		ties := float64(j - i)
+		tieTerm += ties*ties*ties - ties
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+	u = rankSumB - n2*(n2+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		return u, 0, 1
+	}
+	z = (u - mean) / math.Sqrt(variance)
+	p = math.Erfc(math.Abs(z) / math.Sqrt2)
+	return u, z, p
+}
+
+func sortedCopy(values []float64) []float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + labels[key]
+	}
+	return "[" + strings.Join(pairs, " ") + "]"
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    []float64
+		u, z, p float64
+	}{
+		{"separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 9, 1.963961, 0.049535},
+		{"reversed", []float64{4, 5, 6}, []float64{1, 2, 3}, 0, -1.963961, 0.049535},
+		{"ties", []float64{1, 2, 2, 3}, []float64{2, 3, 3, 4}, 13, 1.517442, 0.129155},
+		{"ties across samples", []float64{1, 2, 3, 4, 5}, []float64{3, 3, 3, 6, 7, 8}, 22.5, 1.401530, 0.161056},
+		{"all tied", []float64{5, 5, 5}, []float64{5, 5, 5}, 4.5, 0, 1},
+	}
+	for _, tt := range tests {
+		u, z, p := mannWhitney(tt.a, tt.b)
+		if math.Abs(u-tt.u) > 1e-9 || math.Abs(z-tt.z) > 1e-6 || math.Abs(p-tt.p) > 1e-6 {
+			t.Errorf("%s: mannWhitney() = %v, %v, %v, want %v, %v, %v", tt.name, u, z, p, tt.u, tt.z, tt.p)
+		}
+	}
+}
+
+func TestCompareSeries(t *testing.T) {
+	base := []float64{1.0, 1.1, 0.9, 1.05, 0.95, 1.02, 0.98, 1.01, 0.99, 1.03}
+	slower := make([]float64, len(base))
+	faster := make([]float64, len(base))
+	for i, d := range base {
+		slower[i] = d * 2
+		faster[i] = d / 2
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		seriesID string
+		records  []seriesRecord
+		wantErr  bool
+	}{
+		{"no difference", "current", []seriesRecord{{ID: "current", Script: "run.sh", Start: start.Add(time.Hour), Durations: base}}, false},
+		{"regression", "current", []seriesRecord{{ID: "current", Script: "run.sh", Start: start.Add(time.Hour), Durations: slower}}, true},
+		{"improvement", "current", []seriesRecord{{ID: "current", Script: "run.sh", Start: start.Add(time.Hour), Durations: faster}}, false},
+		{"latest series", "", []seriesRecord{
+			{ID: "old", Script: "run.sh", Start: start.Add(time.Hour), Durations: base},
+			{ID: "new", Script: "run.sh", Start: start.Add(2 * time.Hour), Durations: slower},
+			{ID: "other", Script: "other.sh", Start: start.Add(3 * time.Hour), Durations: base},
+		}, true},
+		{"no successful run", "current", []seriesRecord{{ID: "current", Script: "run.sh", Start: start.Add(time.Hour), Failed: 3}}, true},
+		{"unknown series", "missing", nil, true},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		records := append([]seriesRecord{{ID: "base", Script: "run.sh", Start: start, Durations: base}}, tt.records...)
+		for _, record := range records {
+			if err := writeRecord(filepath.Join(dir, record.ID+".json"), record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := saveBaseline(dir, "base", "release"); err != nil {
+			t.Fatal(err)
+		}
+		if err := compareSeries(dir, "release", tt.seriesID); (err != nil) != tt.wantErr {
+			t.Errorf("%s: compareSeries() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := compareSeries(t.TempDir(), "release", ""); err == nil {
+		t.Error("compareSeries() without a baseline succeeded")
+	}
+}
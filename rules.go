@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// severities lists the valid rule severities, from the least severe.
+var severities = []string{"info", "warning", "error", "critical"}
+
+// matchRule selects the log lines reported by monitorLogs. A line matches
+// when one of the include patterns and none of the exclude patterns match
+// it, in a file matching one of the file globs (all files when empty).
+type matchRule struct {
+	Name          string   `json:"name"`
+	Severity      string   `json:"severity"`
+	Include       []string `json:"include"`
+	Exclude       []string `json:"exclude"`
+	Files         []string `json:"files"`
+	CaseSensitive bool     `json:"case_sensitive"`
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// ruleSet is an ordered list of rules, the first matching rule wins.
+type ruleSet struct {
+	Rules []*matchRule `json:"rules"`
+}
+
+// defaultRules reproduces the historical case-insensitive search for
+// "error", "fail" and "exception".
+func defaultRules() *ruleSet {
+	rules := &ruleSet{Rules: []*matchRule{{
+		Name:     "default",
+		Severity: "error",
+		Include:  []string{"error", "fail", "exception"},
+	}}}
+	if err := rules.compile(); err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// loadRules reads a JSON rules file and validates it.
+func loadRules(path string) (*ruleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules ruleSet
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if len(rules.Rules) == 0 {
+		return nil, fmt.Errorf("%s does not define any rule", path)
+	}
+	if err := rules.compile(); err != nil {
+		return nil, fmt.Errorf("invalid rules in %s: %v", path, err)
+	}
+	return &rules, nil
+}
+
+// compile validates the rules and compiles their patterns.
+func (rs *ruleSet) compile() error {
+	names := make(map[string]bool)
+	for i, rule := range rs.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule name %s", rule.Name)
+		}
+		names[rule.Name] = true
+		if severityRank(rule.Severity) < 0 {
+			return fmt.Errorf("rule %s has an invalid severity %q, expected one of %v", rule.Name, rule.Severity, severities)
+		}
+		if len(rule.Include) == 0 {
+			return fmt.Errorf("rule %s has no include pattern", rule.Name)
+		}
+		for _, glob := range rule.Files {
+			if _, err := filepath.Match(glob, ""); err != nil {
+				return fmt.Errorf("rule %s has an invalid file glob %q", rule.Name, glob)
+			}
+		}
+
+		var err error
+		if rule.include, err = compilePatterns(rule.Include, rule.CaseSensitive); err != nil {
+			return fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+		if rule.exclude, err = compilePatterns(rule.Exclude, rule.CaseSensitive); err != nil {
+			return fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func compilePatterns(patterns []string, caseSensitive bool) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		if !caseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// match returns the first rule matching line of the file at path, or nil.
+func (rs *ruleSet) match(path, line string) *matchRule {
+	for _, rule := range rs.Rules {
+		if rule.appliesTo(path) && rule.matches(line) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// appliesTo reports whether one of the file globs of the rule matches the
+// path or the base name of the file, with or without its .gz extension and
+// rotation suffix.
+func (rule *matchRule) appliesTo(path string) bool {
+	if len(rule.Files) == 0 {
+		return true
+	}
+	for _, glob := range rule.Files {
+		for _, name := range []string{path, filepath.Base(path), trimArchiveSuffix(path), trimArchiveSuffix(filepath.Base(path))} {
+			if ok, _ := filepath.Match(glob, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rule *matchRule) matches(line string) bool {
+	included := false
+	for _, re := range rule.include {
+		if re.MatchString(line) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, re := range rule.exclude {
+		if re.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
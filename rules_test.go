@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testRules(t *testing.T, rules ...*matchRule) *ruleSet {
+	t.Helper()
+	rs := &ruleSet{Rules: rules}
+	if err := rs.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func TestRuleSetMatch(t *testing.T) {
+	rs := testRules(t,
+		&matchRule{Name: "oom", Severity: "critical", Include: []string{`OutOfMemoryError`}, CaseSensitive: true},
+		&matchRule{Name: "db", Severity: "error", Include: []string{`ORA-\d+`, `deadlock`}, Exclude: []string{`ORA-01403`}, Files: []string{"db*.log"}},
+		&matchRule{Name: "app", Severity: "warning", Include: []string{"error", "fail"}, Exclude: []string{"retrying"}, Files: []string{"/var/log/app/*.log"}},
+	)
+	tests := []struct {
+		path string
+		line string
+		want string
+	}{
+		{"/var/log/db1.log", "java.lang.OutOfMemoryError: heap", "oom"},
+		{"/var/log/db1.log", "java.lang.outofmemoryerror: heap", ""},
+		{"/var/log/db1.log", "ORA-00060: deadlock detected", "db"},
+		{"/var/log/db1.log", "Transaction DEADLOCK", "db"},
+		{"/var/log/db1.log", "ORA-01403: no data found", ""},
+		{"/var/log/other.log", "ORA-00060: deadlock detected", ""},
+		{"/var/log/db1.log.gz", "ORA-00600 internal error", "db"},
+		{"/var/log/app/server.log", "Request FAILED", "app"},
+		{"/var/log/app/server.log", "Error, retrying", ""},
+		{"/var/log/app/server.log", "ERROR, RETRYING", ""},
+		{"/var/log/web/server.log", "Request failed", ""},
+		{"/var/log/app/server.log", "all good", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if rule := rs.match(tt.path, tt.line); rule != nil {
+			got = rule.Name
+		}
+		if got != tt.want {
+			t.Errorf("match(%q, %q) = %q, want %q", tt.path, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	rs := defaultRules()
+	for line, want := range map[string]bool{
+		"NullPointerException": true,
+		"Job FAILED":           true,
+		"error: disk full":     true,
+		"started successfully": false,
+	} {
+		if got := rs.match("app.log", line) != nil; got != want {
+			t.Errorf("default rules match %q = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", `{"rules": [{"name": "a", "severity": "info", "include": ["x"]}]}`, ""},
+		{"no rule", `{"rules": []}`, "does not define any rule"},
+		{"no name", `{"rules": [{"severity": "info", "include": ["x"]}]}`, "has no name"},
+		{"duplicate", `{"rules": [{"name": "a", "severity": "info", "include": ["x"]}, {"name": "a", "severity": "info", "include": ["y"]}]}`, "duplicate"},
+		{"severity", `{"rules": [{"name": "a", "severity": "fatal", "include": ["x"]}]}`, "invalid severity"},
+		{"no include", `{"rules": [{"name": "a", "severity": "info"}]}`, "no include pattern"},
+		{"bad pattern", `{"rules": [{"name": "a", "severity": "info", "include": ["("]}]}`, "invalid pattern"},
+		{"bad exclude", `{"rules": [{"name": "a", "severity": "info", "include": ["x"], "exclude": ["["]}]}`, "invalid pattern"},
+		{"bad glob", `{"rules": [{"name": "a", "severity": "info", "include": ["x"], "files": ["["]}]}`, "invalid file glob"},
+		{"bad json", `{"rules": [`, "failed to parse"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadRules(path)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: loadRules() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultInterpreter runs the scripts that do not name an interpreter.
+const defaultInterpreter = "bash"
+
+// scenario is a weighted mix of scripts run by the workers of a series.
+type scenario struct {
+	Name    string       `json:"name"`
+	Scripts []scriptSpec `json:"scripts"`
+
+	totalWeight int
+}
+
+// scriptSpec describes a script of a scenario and how to launch it.
+// Interpreter is a command line such as "python3 -u", or "none" to execute
+// the script directly.
+type scriptSpec struct {
+	Name        string            `json:"name"`
+	Script      string            `json:"script"`
+	Weight      int               `json:"weight"`
+	Args        []string          `json:"args"`
+	Env         map[string]string `json:"env"`
+	Dir         string            `json:"dir"`
+	Interpreter string            `json:"interpreter"`
+
+	// index is the 1-based position of the script in a scenario of several
+	// scripts. It tells apart the output files of scripts with the same base
+	// name in different directories.
+	index int
+}
+
+// singleScriptScenario returns the scenario running script alone with bash,
+// as executeAndTime always did.
+func singleScriptScenario(script string) *scenario {
+	return &scenario{
+		Name:        script,
+		Scripts:     []scriptSpec{{Name: script, Script: script, Weight: 1, Interpreter: defaultInterpreter}},
+		totalWeight: 1,
+	}
+}
+
+// loadScenario reads and validates a JSON scenario file.
+func loadScenario(path string) (*scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sc scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(sc.Scripts) == 0 {
+		return nil, fmt.Errorf("%s does not list any script", path)
+	}
+
+	names := make(map[string]bool)
+	for i := range sc.Scripts {
+		spec := &sc.Scripts[i]
+		if spec.Script == "" {
+			return nil, fmt.Errorf("script %d of %s has no path", i+1, path)
+		}
+		if spec.Name == "" {
+			spec.Name = spec.Script
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("duplicate script name %s in %s", spec.Name, path)
+		}
+		names[spec.Name] = true
+		if spec.Weight < 0 {
+			return nil, fmt.Errorf("script %s has a negative weight", spec.Name)
+		}
+		if spec.Weight == 0 {
+			spec.Weight = 1
+		}
+		if spec.Interpreter == "" {
+			spec.Interpreter = defaultInterpreter
+		}
+		if len(sc.Scripts) > 1 {
+			spec.index = i + 1
+		}
+		sc.totalWeight += spec.Weight
+	}
+	return &sc, nil
+}
+
+// pick chooses a script of the scenario according to the weights.
+func (sc *scenario) pick(r *rand.Rand) *scriptSpec {
+	if len(sc.Scripts) == 1 {
+		return &sc.Scripts[0]
+	}
+	n := r.Intn(sc.totalWeight)
+	for i := range sc.Scripts {
+		n -= sc.Scripts[i].Weight
+		if n < 0 {
+			return &sc.Scripts[i]
+		}
+	}
+	return &sc.Scripts[len(sc.Scripts)-1]
+}
+
+// command builds the command running the script.
+func (spec *scriptSpec) command() *exec.Cmd {
+	var args []string
+	if spec.Interpreter != "none" {
+		args = strings.Fields(spec.Interpreter)
+	}
+	args = append(args, spec.Script)
+	args = append(args, spec.Args...)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = spec.Dir
+	if len(spec.Env) > 0 {
+		cmd.Env = os.Environ()
+		for key, value := range spec.Env {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	return cmd
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputFileBaseSameNamedScripts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	data := `{"scripts": [{"script": "a/run.sh"}, {"script": "b/run.sh"}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := loadScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec    *scriptSpec
+		worker  int
+		run     int
+		attempt int
+		opts    executeOptions
+		want    string
+	}{
+		{&sc.Scripts[0], 1, 3, 1, executeOptions{workers: 1}, "run_script1_run3"},
+		{&sc.Scripts[1], 1, 3, 1, executeOptions{workers: 1}, "run_script2_run3"},
+		{&sc.Scripts[1], 2, 3, 2, executeOptions{workers: 4}, "run_script2_worker2_run3_attempt2"},
+		{&singleScriptScenario("/tmp/run.sh").Scripts[0], 1, 1, 1, executeOptions{workers: 1}, "run_run1"},
+	}
+	for _, tt := range tests {
+		if got := outputFileBase(tt.spec, tt.worker, tt.run, tt.attempt, tt.opts); got != tt.want {
+			t.Errorf("outputFileBase(%s, %d, %d, %d) = %s, want %s", tt.spec.Name, tt.worker, tt.run, tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// seriesState is the progress of a series, persisted after each run so that
+// an interrupted series can be resumed from the next iteration of each
+// worker. Only the data rows of completed runs count as consumed: DataNext
+// is the first sequential row whose run did not complete, DataDone the
+// later ones whose run did, and DataWorkerNext the next pass of each worker
+// in the unique mode.
+type seriesState struct {
+	Scenario       string      `json:"scenario"`
+	Workers        int         `json:"workers"`
+	Times          int         `json:"times"`
+	Elapsed        float64     `json:"elapsed_seconds"`
+	Next           map[int]int `json:"next"`
+	DataNext       int         `json:"data_next"`
+	DataDone       []int       `json:"data_done,omitempty"`
+	DataWorkerNext map[int]int `json:"data_worker_next,omitempty"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// defaultStateFile names the state file of a series of sc.
+func defaultStateFile(sc *scenario) string {
+	return strings.TrimSuffix(filepath.Base(sc.Name), filepath.Ext(sc.Name)) + ".series_state.json"
+}
+
+func newSeriesState(path string, sc *scenario, times int, opts executeOptions) *seriesState {
+	state := &seriesState{Scenario: sc.Name, Workers: opts.workers, Times: times, Next: make(map[int]int), DataWorkerNext: make(map[int]int), path: path}
+	for w := 1; w <= opts.workers; w++ {
+		state.Next[w] = 1
+	}
+	return state
+}
+
+// loadSeriesState reads the state left by an interrupted series and checks
+// that it belongs to the same series.
+func loadSeriesState(path string, sc *scenario, times int, opts executeOptions) (*seriesState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no interrupted series to resume: %s does not exist", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &seriesState{path: path}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if state.Scenario != sc.Name || state.Workers != opts.workers || state.Times != times {
+		return nil, fmt.Errorf("%s records %s with %d workers and %d times, not %s with %d workers and %d times",
+			path, state.Scenario, state.Workers, state.Times, sc.Name, opts.workers, times)
+	}
+	if state.Next == nil {
+		state.Next = make(map[int]int)
+	}
+	if state.DataWorkerNext == nil {
+		state.DataWorkerNext = make(map[int]int)
+	}
+	return state, nil
+}
+
+// next returns the first iteration of worker.
+func (state *seriesState) next(worker int) int {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.Next[worker] < 1 {
+		return 1
+	}
+	return state.Next[worker]
+}
+
+// advance records that worker completed iteration run, which consumed row
+// when the series binds data, and saves the state.
+func (state *seriesState) advance(worker int, run int, elapsed time.Duration, row *dataRow) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.Next[worker] = run + 1
+	state.Elapsed = elapsed.Seconds()
+	if row != nil {
+		state.consumeLocked(worker, *row)
+	}
+	if err := state.saveLocked(); err != nil {
+		writeLog(logfile, fmt.Sprintf("Failed to save series state to %s: %v\n", state.path, err))
+	}
+}
+
+// consumeLocked records the row consumed by a completed run of worker. The
+// sequential rows complete out of order when several workers share them.
+func (state *seriesState) consumeLocked(worker int, row dataRow) {
+	switch row.mode {
+	case "random":
+		return
+	case "unique":
+		state.DataWorkerNext[worker] = row.seq + 1
+		return
+	}
+	if row.seq < state.DataNext {
+		return
+	}
+	i := sort.SearchInts(state.DataDone, row.seq)
+	if i < len(state.DataDone) && state.DataDone[i] == row.seq {
+		return
+	}
+	state.DataDone = append(state.DataDone, 0)
+	copy(state.DataDone[i+1:], state.DataDone[i:])
+	state.DataDone[i] = row.seq
+	for len(state.DataDone) > 0 && state.DataDone[0] == state.DataNext {
+		state.DataDone = state.DataDone[1:]
+		state.DataNext++
+	}
+}
+
+// restoreData moves the cursors of data to the first rows not consumed by
+// the completed runs of the interrupted series.
+func (state *seriesState) restoreData(data *dataSource) {
+	data.mu.Lock()
+	defer data.mu.Unlock()
+	data.next = state.DataNext
+	data.done = make(map[int]bool, len(state.DataDone))
+	for _, seq := range state.DataDone {
+		data.done[seq] = true
+	}
+	for w, n := range state.DataWorkerNext {
+		data.workerNext[w] = n
+	}
+}
+
+// saveLocked writes the state to a temporary file renamed over the state
+// file, so that an interruption while saving leaves the previous state.
+func (state *seriesState) saveLocked() error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := state.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, state.path)
+}
+
+// remove deletes the state file once the series is over.
+func (state *seriesState) remove() {
+	if err := os.Remove(state.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeLog(logfile, fmt.Sprintf("Failed to remove %s: %v\n", state.path, err))
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testDataSource(mode string, workers int) *dataSource {
+	return &dataSource{
+		header:     []string{"id"},
+		rows:       [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}, {"f"}},
+		mode:       mode,
+		onEnd:      "stop",
+		workers:    workers,
+		workerNext: make(map[int]int),
+	}
+}
+
+func TestSeriesStateResumesIncompleteRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		workers int
+		// handed are the workers taking a row in turn, completed the indexes
+		// in handed of the runs that completed before the interruption.
+		handed    []int
+		completed []int
+		// resumed are the workers taking a row after resuming, want the rows
+		// they get.
+		resumed []int
+		want    []string
+	}{
+		{"sequential in order", "sequential", 2, []int{1, 2, 1}, []int{0, 1, 2}, []int{1, 2}, []string{"d", "e"}},
+		{"sequential in flight", "sequential", 3, []int{1, 2, 3, 1}, []int{0, 2, 3}, []int{2, 1, 3}, []string{"b", "e", "f"}},
+		{"unique in flight", "unique", 2, []int{1, 2, 1}, []int{0, 2}, []int{2, 1, 2}, []string{"b", "e", "d"}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "state.json")
+		sc := singleScriptScenario("run.sh")
+		opts := executeOptions{workers: tt.workers}
+		state := newSeriesState(path, sc, 0, opts)
+		data := testDataSource(tt.mode, tt.workers)
+		rows := make([]dataRow, len(tt.handed))
+		for i, worker := range tt.handed {
+			row, ok := data.row(worker, nil)
+			if !ok {
+				t.Fatalf("%s: row(%d) exhausted", tt.name, worker)
+			}
+			rows[i] = row
+		}
+		for _, i := range tt.completed {
+			state.advance(tt.handed[i], 1, time.Second, &rows[i])
+		}
+
+		loaded, err := loadSeriesState(path, sc, 0, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumed := testDataSource(tt.mode, tt.workers)
+		loaded.restoreData(resumed)
+		for i, worker := range tt.resumed {
+			row, ok := resumed.row(worker, nil)
+			if !ok || row.values[0] != tt.want[i] {
+				t.Errorf("%s: resumed row %d of worker %d = %v, %v, want %s", tt.name, i+1, worker, row.values, ok, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSeriesStateRandomRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := newSeriesState(path, singleScriptScenario("run.sh"), 0, executeOptions{workers: 1})
+	data := testDataSource("random", 1)
+	row, _ := data.row(1, rand.New(rand.NewSource(1)))
+	state.advance(1, 1, time.Second, &row)
+	if state.DataNext != 0 || len(state.DataDone) != 0 || len(state.DataWorkerNext) != 0 {
+		t.Errorf("random row recorded as %d, %v, %v", state.DataNext, state.DataDone, state.DataWorkerNext)
+	}
+}
+
+func TestSeriesStateSaveReplacesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	sc := singleScriptScenario("run.sh")
+	opts := executeOptions{workers: 1}
+	state := newSeriesState(path, sc, 5, opts)
+	for run := 1; run <= 3; run++ {
+		state.advance(1, run, time.Duration(run)*time.Second, nil)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary state file left behind: %v", err)
+	}
+	loaded, err := loadSeriesState(path, sc, 5, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.next(1) != 4 || loaded.Elapsed != 3 {
+		t.Errorf("loaded state next %d elapsed %v, want 4 and 3", loaded.next(1), loaded.Elapsed)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const histogramBuckets = 10
+const histogramWidth = 40
+
+// seriesStats summarizes the execution times of a series, in seconds.
+type seriesStats struct {
+	Script    string            `json:"script"`
+	Count     int               `json:"count"`
+	Failed    int               `json:"failed"`
+	TimedOut  int               `json:"timed_out"`
+	Min       float64           `json:"min"`
+	Max       float64           `json:"max"`
+	Mean      float64           `json:"mean"`
+	StdDev    float64           `json:"stddev"`
+	P50       float64           `json:"p50"`
+	P90       float64           `json:"p90"`
+	P95       float64           `json:"p95"`
+	P99       float64           `json:"p99"`
+	Histogram []histogramBucket `json:"histogram"`
+
+	Resources *resourceStats `json:"resources,omitempty"`
+
+	// Scripts holds the statistics of each script of a scenario.
+	Scripts []seriesStats `json:"scripts,omitempty"`
+}
+
+// histogramBucket counts the execution times in [Lower, Upper).
+type histogramBucket struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+// computeStats computes the statistics of the given durations in seconds.
+func computeStats(script string, durations []float64, failed int, timedOut int) seriesStats {
+	stats := seriesStats{Script: script, Count: len(durations), Failed: failed, TimedOut: timedOut}
+	if len(durations) == 0 {
+		return stats
+	}
+
+	sorted := append([]float64(nil), durations...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, d := range sorted {
+		sum += d
+	}
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.Mean = sum / float64(len(sorted))
+
+	var squares float64
+	for _, d := range sorted {
+		squares += (d - stats.Mean) * (d - stats.Mean)
+	}
+	if len(sorted) > 1 {
+		stats.StdDev = math.Sqrt(squares / float64(len(sorted)-1))
+	}
+
+	stats.P50 = percentile(sorted, 50)
+	stats.P90 = percentile(sorted, 90)
+	stats.P95 = percentile(sorted, 95)
+	stats.P99 = percentile(sorted, 99)
+	stats.Histogram = histogram(sorted, histogramBuckets)
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted using linear interpolation
+// between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+func histogram(sorted []float64, buckets int) []histogramBucket {
+	min, max := sorted[0], sorted[len(sorted)-1]
+	if min == max {
+		return []histogramBucket{{Lower: min, Upper: max, Count: len(sorted)}}
+	}
+
+	width := (max - min) / float64(buckets)
+	result := make([]histogramBucket, buckets)
+	for i := range result {
+		result[i].Lower = min + float64(i)*width
+		result[i].Upper = min + float64(i+1)*width
+	}
+	for _, d := range sorted {
+		i := int((d - min) / width)
+		if i >= buckets {
+			i = buckets - 1
+		}
+		result[i].Count++
+	}
+	return result
+}
+
+// formatStats renders stats as the text report printed at the end of a series.
+func formatStats(stats seriesStats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Statistics for %s (%d successful runs, %d failed, %d timed out):\n", stats.Script, stats.Count, stats.Failed, stats.TimedOut)
+	if stats.Count == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "  min %.3fs  max %.3fs  mean %.3fs  stddev %.3fs\n", stats.Min, stats.Max, stats.Mean, stats.StdDev)
+	fmt.Fprintf(&b, "  p50 %.3fs  p90 %.3fs  p95 %.3fs  p99 %.3fs\n", stats.P50, stats.P90, stats.P95, stats.P99)
+	if r := stats.Resources; r != nil {
+		fmt.Fprintf(&b, "  peak RSS mean %.1f MB max %.1f MB  CPU user %.3fs system %.3fs (%.0f%% of run time)\n",
+			r.MeanPeakRSS/(1024*1024), float64(r.MaxPeakRSS)/(1024*1024), r.MeanUserCPU, r.MeanSystemCPU, r.CPUShare*100)
+		fmt.Fprintf(&b, "  context switches %.0f voluntary %.0f involuntary  I/O read %.0f bytes written %.0f bytes (means)\n",
+			r.MeanVoluntaryCtxSwitches, r.MeanInvoluntaryCtxSwitches, r.MeanReadBytes, r.MeanWriteBytes)
+	}
+
+	largest := 0
+	for _, bucket := range stats.Histogram {
+		if bucket.Count > largest {
+			largest = bucket.Count
+		}
+	}
+	for _, bucket := range stats.Histogram {
+		bar := bucket.Count * histogramWidth / largest
+		fmt.Fprintf(&b, "  %9.3fs - %9.3fs | %-*s %d\n", bucket.Lower, bucket.Upper, histogramWidth, strings.Repeat("#", bar), bucket.Count)
+	}
+	return b.String()
+}
+
+// writeStatsFiles writes stats as JSON and CSV next to pac_weiyu.log and
+// returns the paths of the two files. The CSV file has a row for the series
+// followed by a row for each script of a scenario. The names carry the
+// milliseconds, and a counter when two series still end at the same time.
+func writeStatsFiles(stats seriesStats, at time.Time) (string, string, error) {
+	script := strings.TrimSuffix(filepath.Base(stats.Script), filepath.Ext(stats.Script))
+	base := fmt.Sprintf("pac_weiyu_summary_%s_%s_%03d", script, at.Format("20060102_150405"), at.Nanosecond()/int(time.Millisecond))
+	dir := filepath.Dir(logfile.Name())
+	name := base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, name+".json")); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	jsonFile := filepath.Join(dir, name+".json")
+	csvFile := filepath.Join(dir, name+".csv")
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(jsonFile, data, 0644); err != nil {
+		return "", "", err
+	}
+
+	file, err := os.Create(csvFile)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', 6, 64) }
+	w := csv.NewWriter(file)
+	w.Write([]string{"script", "count", "failed", "timed_out", "min", "max", "mean", "stddev", "p50", "p90", "p95", "p99"})
+	for _, s := range append([]seriesStats{stats}, stats.Scripts...) {
+		w.Write([]string{s.Script, strconv.Itoa(s.Count), strconv.Itoa(s.Failed), strconv.Itoa(s.TimedOut),
+			format(s.Min), format(s.Max), format(s.Mean), format(s.StdDev),
+			format(s.P50), format(s.P90), format(s.P95), format(s.P99)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", "", err
+	}
+	return jsonFile, csvFile, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 50, 0},
+		{[]float64{3}, 99, 3},
+		{[]float64{1, 2, 3, 4, 5}, 0, 1},
+		{[]float64{1, 2, 3, 4, 5}, 50, 3},
+		{[]float64{1, 2, 3, 4, 5}, 100, 5},
+		{[]float64{1, 2, 3, 4}, 50, 2.5},
+		{[]float64{10, 20}, 90, 19},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []float64
+		want      seriesStats
+	}{
+		{"empty", nil, seriesStats{Script: "empty", Failed: 1, TimedOut: 2}},
+		{"single", []float64{2}, seriesStats{Script: "single", Count: 1, Failed: 1, TimedOut: 2, Min: 2, Max: 2, Mean: 2, P50: 2, P90: 2, P95: 2, P99: 2}},
+		{"unsorted", []float64{4, 1, 3, 2}, seriesStats{Script: "unsorted", Count: 4, Failed: 1, TimedOut: 2, Min: 1, Max: 4, Mean: 2.5, StdDev: math.Sqrt(5.0 / 3), P50: 2.5, P90: 3.7, P95: 3.85, P99: 3.97}},
+	}
+	for _, tt := range tests {
+		got := computeStats(tt.name, tt.durations, 1, 2)
+		if got.Script != tt.want.Script || got.Count != tt.want.Count || got.Failed != tt.want.Failed || got.TimedOut != tt.want.TimedOut {
+			t.Errorf("%s: counts = %+v, want %+v", tt.name, got, tt.want)
+		}
+		for _, f := range []struct {
+			name      string
+			got, want float64
+		}{
+			{"min", got.Min, tt.want.Min}, {"max", got.Max, tt.want.Max},
+			{"mean", got.Mean, tt.want.Mean}, {"stddev", got.StdDev, tt.want.StdDev},
+			{"p50", got.P50, tt.want.P50}, {"p90", got.P90, tt.want.P90},
+			{"p95", got.P95, tt.want.P95}, {"p99", got.P99, tt.want.P99},
+		} {
+			if math.Abs(f.got-f.want) > 1e-9 {
+				t.Errorf("%s: %s = %v, want %v", tt.name, f.name, f.got, f.want)
+			}
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		sorted  []float64
+		buckets int
+		want    []histogramBucket
+	}{
+		{[]float64{2, 2, 2}, 4, []histogramBucket{{2, 2, 3}}},
+		{[]float64{0, 1, 2, 3, 4}, 2, []histogramBucket{{0, 2, 2}, {2, 4, 3}}},
+		{[]float64{0, 0.5, 1, 4}, 4, []histogramBucket{{0, 1, 2}, {1, 2, 1}, {2, 3, 0}, {3, 4, 1}}},
+	}
+	for _, tt := range tests {
+		got := histogram(tt.sorted, tt.buckets)
+		if len(got) != len(tt.want) {
+			t.Errorf("histogram(%v, %d) = %v, want %v", tt.sorted, tt.buckets, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("histogram(%v, %d) = %v, want %v", tt.sorted, tt.buckets, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestWriteStatsFilesSameTime(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 250*int(time.Millisecond), time.Local)
+	stats := computeStats("/tmp/run.sh", []float64{1, 2}, 0, 0)
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		jsonFile, csvFile, err := writeStatsFiles(stats, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[jsonFile] || seen[csvFile] {
+			t.Fatalf("summary %d overwrote %s", i+1, jsonFile)
+		}
+		seen[jsonFile], seen[csvFile] = true, true
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// fileTail follows a file, remembering how far it has been read so that
+// each appended line is returned exactly once. The file stays open, so the
+// lines written to it after it was renamed by a log rotation can still be
+// read before switching to the new file.
+type fileTail struct {
+	path   string
+	file   *os.File
+	offset int64
+
+	// partial holds the last line read when it has no newline yet.
+	partial []byte
+	// lineStart and lineNumber locate the next line to return. lineNumber
+	// is 0 until the lines before lineStart are counted, which is only done
+	// when a line is read from a file opened at an offset of unknown line.
+	lineStart  int64
+	lineNumber int
+}
+
+// tailLine is a line read by a fileTail with its byte offset and its
+// 1-based number in the file.
+type tailLine struct {
+	text   string
+	offset int64
+	number int
+}
+
+// openFileTail starts following path at offset, the start of line number
+// line, 0 when unknown.
+func openFileTail(path string, offset int64, line int) (*fileTail, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if offset == 0 {
+		line = 1
+	}
+	return &fileTail{path: path, file: file, offset: offset, lineStart: offset, lineNumber: line}, nil
+}
+
+func countLines(r io.Reader) (int, error) {
+	buf := make([]byte, 64*1024)
+	count := 0
+	for {
+		n, err := r.Read(buf)
+		count += bytes.Count(buf[:n], []byte("\n"))
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// lineStartBefore returns the start of the line holding the byte before
+// offset in the file at path, which is offset itself when a line ends
+// there. It returns 0 when the file is now shorter than offset.
+func lineStartBefore(path string, offset int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if offset > info.Size() {
+		return 0, nil
+	}
+	buf := make([]byte, 64*1024)
+	for end := offset; end > 0; {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		start := end - n
+		if _, err := file.ReadAt(buf[:n], start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// readLines returns the complete lines appended since the previous call.
+// A trailing line without a newline is kept until it is completed. When the
+// file shrank below the offset it was truncated in place, as done by
+// copytruncate rotations, and it is read again from the start.
+func (t *fileTail) readLines() ([]tailLine, error) {
+	info, err := t.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < t.offset {
+		t.rewind()
+	}
+
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(t.file)
+	if err != nil {
+		return nil, err
+	}
+	t.offset += int64(len(data))
+
+	data = append(t.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		t.partial = data
+		return nil, nil
+	}
+	t.partial = append([]byte(nil), data[end+1:]...)
+
+	if err := t.numberLines(); err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(data[:end], []byte("\n"))
+	result := make([]tailLine, len(lines))
+	for i, line := range lines {
+		result[i] = t.next(line)
+	}
+	return result, nil
+}
+
+// numberLines counts the lines before the next one to return if their
+// number is not known yet.
+func (t *fileTail) numberLines() error {
+	if t.lineNumber > 0 {
+		return nil
+	}
+	count, err := countLines(io.NewSectionReader(t.file, 0, t.lineStart))
+	if err != nil {
+		return err
+	}
+	t.lineNumber = count + 1
+	return nil
+}
+
+// next returns line, read at the position of the next line, and moves to
+// the line after it.
+func (t *fileTail) next(line []byte) tailLine {
+	l := tailLine{text: string(bytes.TrimSuffix(line, []byte("\r"))), offset: t.lineStart, number: t.lineNumber}
+	t.lineStart += int64(len(line)) + 1
+	t.lineNumber++
+	return l
+}
+
+func (t *fileTail) rewind() {
+	t.offset = 0
+	t.partial = nil
+	t.lineStart = 0
+	t.lineNumber = 1
+}
+
+// drain returns the remaining lines of a file that no longer grows,
+// including a last line without a newline.
+func (t *fileTail) drain() ([]tailLine, error) {
+	lines, err := t.readLines()
+	if err != nil {
+		return nil, err
+	}
+	if len(t.partial) > 0 {
+		if err := t.numberLines(); err != nil {
+			return nil, err
+		}
+		lines = append(lines, t.next(t.partial))
+		t.partial = nil
+	}
+	return lines, nil
+}
+
+// stat describes the file being read, which is no longer the file at the
+// path once it was rotated away.
+func (t *fileTail) stat() (os.FileInfo, error) {
+	return t.file.Stat()
+}
+
+// reopen switches to the file now at the path, read from its start, after
+// the followed file was rotated away. The caller reads the remaining lines
+// of the old file first.
+func (t *fileTail) reopen() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	t.file.Close()
+	t.file = file
+	t.rewind()
+	return nil
+}
+
+func (t *fileTail) close() error {
+	return t.file.Close()
+}
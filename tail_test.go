@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// appendFile appends data to the file at path, creating it if needed.
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileTailPartialLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		// want holds the lines returned after each write.
+		want [][]tailLine
+	}{
+		{"complete lines", []string{"a\nb\n"}, [][]tailLine{{{"a", 0, 1}, {"b", 2, 2}}}},
+		{"line completed later", []string{"first par", "t\nsecond\n"}, [][]tailLine{nil, {{"first part", 0, 1}, {"second", 11, 2}}}},
+		{"trailing partial line", []string{"one\ntw", "o\nthr", "ee\n"}, [][]tailLine{{{"one", 0, 1}}, {{"two", 4, 2}}, {{"three", 8, 3}}}},
+		{"crlf", []string{"dos\r\n"}, [][]tailLine{{{"dos", 0, 1}}}},
+		{"empty lines", []string{"\n\nx\n"}, [][]tailLine{{{"", 0, 1}, {"", 1, 2}, {"x", 2, 3}}}},
+		{"nothing new", []string{"a\n", ""}, [][]tailLine{{{"a", 0, 1}}, nil}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "app.log")
+		appendFile(t, path, "")
+		tail, err := openFileTail(path, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, data := range tt.writes {
+			appendFile(t, path, data)
+			got, err := tail.readLines()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want[i]) {
+				t.Errorf("%s: lines after write %d = %v, want %v", tt.name, i+1, got, tt.want[i])
+			}
+		}
+		tail.close()
+	}
+}
+
+func TestFileTailDrainsLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "done\nno newline")
+	tail, err := openFileTail(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tail.close()
+	got, err := tail.drain()
+	want := []tailLine{{"done", 0, 1}, {"no newline", 5, 2}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("drain() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestOpenFileTailAtOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "a\nb\nc\n")
+	tail, err := openFileTail(path, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tail.close()
+	got, err := tail.readLines()
+	want := []tailLine{{"c", 4, 3}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("readLines() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestFileTailTruncation(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  string
+		rewrite string
+		want    []tailLine
+	}{
+		{"truncated and rewritten", "one\ntwo\nthree\n", "new\n", []tailLine{{"new", 0, 1}}},
+		{"truncated to nothing", "one\ntwo\n", "", nil},
+		{"truncated with partial line pending", "one\ntw", "x\n", []tailLine{{"x", 0, 1}}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "app.log")
+		appendFile(t, path, tt.before)
+		tail, err := openFileTail(path, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tail.readLines(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(path, 0); err != nil {
+			t.Fatal(err)
+		}
+		appendFile(t, path, tt.rewrite)
+		got, err := tail.readLines()
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: readLines() = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+		tail.close()
+	}
+}
+
+func TestFileTailRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "old 1\n")
+	tail, err := openFileTail(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tail.close()
+	if _, err := tail.readLines(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines written to the rotated file before the writer reopens the log
+	// are still read from the old file.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path+".1", "old 2\nold 3")
+	appendFile(t, path, "new 1\n")
+	got, err := tail.drain()
+	want := []tailLine{{"old 2", 6, 2}, {"old 3", 12, 3}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("drain() of the rotated file = %v, %v, want %v", got, err, want)
+	}
+
+	if err := tail.reopen(); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "new 2\n")
+	got, err = tail.readLines()
+	want = []tailLine{{"new 1", 0, 1}, {"new 2", 6, 2}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("readLines() after reopen = %v, %v, want %v", got, err, want)
+	}
+	info, err := tail.stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.Stat(path)
+	if err != nil || !os.SameFile(info, current) {
+		t.Errorf("tail follows %v after reopen, not %s", info.Name(), path)
+	}
+}
+
+func TestFileTailLineNumbers(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int64
+		line   int
+		want   tailLine
+	}{
+		{"start", 0, 0, tailLine{"c", 4, 3}},
+		{"known line", 4, 3, tailLine{"c", 4, 3}},
+		{"line from a checkpoint", 4, 30, tailLine{"c", 4, 30}},
+		{"counted on first read", 4, 0, tailLine{"c", 4, 3}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "app.log")
+		appendFile(t, path, "a\nb\n")
+		tail, err := openFileTail(path, tt.offset, tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.offset == 0 {
+			tail.readLines()
+		}
+		appendFile(t, path, "c\nd")
+		got, err := tail.drain()
+		if err != nil || len(got) != 2 || got[0] != tt.want || got[1].number != tt.want.number+1 {
+			t.Errorf("%s: drain() = %v, %v, want %v then the next line", tt.name, got, err, tt.want)
+		}
+		cp, err := tail.checkpoint()
+		if err != nil || cp.Line != tt.want.number+2 {
+			t.Errorf("%s: checkpoint line = %d, %v, want %d", tt.name, cp.Line, err, tt.want.number+2)
+		}
+		tail.close()
+	}
+}
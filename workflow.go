@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// workflow is a DAG of scripts, such as the EOD processing chain.
+type workflow struct {
+	Name  string         `json:"name"`
+	Steps []workflowStep `json:"steps"`
+}
+
+// workflowStep is a script of a workflow that starts once all the steps it
+// depends on succeeded.
+type workflowStep struct {
+	scriptSpec
+	DependsOn []string `json:"depends_on"`
+	Timeout   string   `json:"timeout"`
+	Retries   int      `json:"retries"`
+
+	timeout time.Duration
+	// output names the output files of the step, which steps running the
+	// same script must not share.
+	output string
+}
+
+// workflowState is persisted after each step so that a failed workflow can
+// be resumed from its failed steps.
+type workflowState struct {
+	Workflow  string                       `json:"workflow"`
+	Completed map[string]completedStepInfo `json:"completed"`
+}
+
+type completedStepInfo struct {
+	Duration float64   `json:"duration"`
+	End      time.Time `json:"end"`
+}
+
+// workflowOptions holds the optional settings of runWorkflow.
+type workflowOptions struct {
+	concurrency int
+	resume      bool
+	stateFile   string
+	outputDir   string
+}
+
+func parseWorkflowOptions(workflowFile string, args []string) (workflowOptions, error) {
+	var opts workflowOptions
+	fs := flag.NewFlagSet("runWorkflow", flag.ContinueOnError)
+	fs.IntVar(&opts.concurrency, "concurrency", 4, "maximum number of steps running at the same time")
+	fs.BoolVar(&opts.resume, "resume", false, "skip the steps completed by the previous invocation")
+	fs.StringVar(&opts.stateFile, "state", strings.TrimSuffix(workflowFile, filepath.Ext(workflowFile))+".state.json", "file recording the completed steps")
+	fs.StringVar(&opts.outputDir, "output-dir", "runs", "directory receiving the stdout and stderr of each step")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if opts.concurrency < 1 {
+		return opts, fmt.Errorf("invalid concurrency: %d", opts.concurrency)
+	}
+	return opts, nil
+}
+
+// loadWorkflow reads a JSON workflow file and checks that its steps form a
+// DAG.
+func loadWorkflow(path string) (*workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var wf workflow
+	if err := json.Unmarshal(data, &wf); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if wf.Name == "" {
+		wf.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(wf.Steps) == 0 {
+		return nil, fmt.Errorf("%s does not list any step", path)
+	}
+
+	steps := make(map[string]*workflowStep)
+	outputs := make(map[string]*workflowStep)
+	for i := range wf.Steps {
+		step := &wf.Steps[i]
+		if step.Script == "" {
+			return nil, fmt.Errorf("step %d of %s has no script", i+1, path)
+		}
+		if step.Name == "" {
+			step.Name = step.Script
+		}
+		if steps[step.Name] != nil {
+			return nil, fmt.Errorf("duplicate step name %s in %s", step.Name, path)
+		}
+		steps[step.Name] = step
+		step.output = stepOutputName(step.Name)
+		if other := outputs[step.output]; other != nil {
+			return nil, fmt.Errorf("steps %s and %s of %s would write the same output files", other.Name, step.Name, path)
+		}
+		outputs[step.output] = step
+		if step.Interpreter == "" {
+			step.Interpreter = defaultInterpreter
+		}
+		if step.Timeout != "" {
+			if step.timeout, err = time.ParseDuration(step.Timeout); err != nil {
+				return nil, fmt.Errorf("invalid timeout of step %s: %v", step.Name, err)
+			}
+		}
+		if step.Retries < 0 {
+			return nil, fmt.Errorf("step %s has a negative number of retries", step.Name)
+		}
+	}
+	for _, step := range wf.Steps {
+		for _, dep := range step.DependsOn {
+			if steps[dep] == nil {
+				return nil, fmt.Errorf("step %s depends on unknown step %s", step.Name, dep)
+			}
+		}
+	}
+	if _, err := topologicalOrder(wf.Steps); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+// stepOutputName turns a step name, which defaults to the path of its
+// script, into a file name by replacing the characters other than letters,
+// digits, dots, dashes and underscores.
+func stepOutputName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(".-_", r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// topologicalOrder orders the steps so that each comes after its
+// dependencies, or fails when the dependencies have a cycle.
+func topologicalOrder(steps []workflowStep) ([]string, error) {
+	pending := make(map[string]int)
+	dependents := make(map[string][]string)
+	for _, step := range steps {
+		pending[step.Name] = len(step.DependsOn)
+		for _, dep := range step.DependsOn {
+			dependents[dep] = append(dependents[dep], step.Name)
+		}
+	}
+
+	var order, ready []string
+	for _, step := range steps {
+		if pending[step.Name] == 0 {
+			ready = append(ready, step.Name)
+		}
+	}
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+		for _, dependent := range dependents[name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(order) != len(steps) {
+		return nil, errors.New("the dependencies of the workflow steps have a cycle")
+	}
+	return order, nil
+}
+
+func loadWorkflowState(path, name string) (*workflowState, error) {
+	state := &workflowState{Workflow: name, Completed: make(map[string]completedStepInfo)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if state.Workflow != name {
+		return nil, fmt.Errorf("%s records workflow %s, not %s", path, state.Workflow, name)
+	}
+	if state.Completed == nil {
+		state.Completed = make(map[string]completedStepInfo)
+	}
+	return state, nil
+}
+
+// save writes the state to path. The file is replaced atomically so that
+// an interrupt never leaves a truncated state behind.
+func (state *workflowState) save(path string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// stepOutcome is sent by a finished step to the scheduler.
+type stepOutcome struct {
+	name   string
+	result runResult
+}
+
+// runWorkflow runs the steps of a workflow, independent steps in parallel,
+// and returns an error when a step failed.
+func runWorkflow(workflowFile string, opts workflowOptions) error {
+	wf, err := loadWorkflow(workflowFile)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(opts.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	state := &workflowState{Workflow: wf.Name, Completed: make(map[string]completedStepInfo)}
+	if opts.resume {
+		if state, err = loadWorkflowState(opts.stateFile, wf.Name); err != nil {
+			return err
+		}
+	}
+
+	steps := make(map[string]*workflowStep)
+	pending := make(map[string]int)
+	dependents := make(map[string][]string)
+	for i := range wf.Steps {
+		step := &wf.Steps[i]
+		steps[step.Name] = step
+		for _, dep := range step.DependsOn {
+			dependents[dep] = append(dependents[dep], step.Name)
+			if _, done := state.Completed[dep]; !done {
+				pending[step.Name]++
+			}
+		}
+	}
+
+	start := time.Now()
+	writeLog(logfile, fmt.Sprintf("Starting workflow %s at %s\n", wf.Name, start))
+	results := make(map[string]runResult)
+	skipped := make(map[string]bool)
+	var ready []string
+	for _, step := range wf.Steps {
+		if _, done := state.Completed[step.Name]; done {
+			writeLog(logfile, fmt.Sprintf("Workflow %s: step %s already completed, skipping\n", wf.Name, step.Name))
+			continue
+		}
+		if pending[step.Name] == 0 {
+			ready = append(ready, step.Name)
+		}
+	}
+
+	outcomes := make(chan stepOutcome)
+	running := 0
+	for len(ready) > 0 || running > 0 {
+		for len(ready) > 0 && running < opts.concurrency {
+			step := steps[ready[0]]
+			ready = ready[1:]
+			running++
+			go func(step *workflowStep) {
+				stepOpts := executeOptions{
+					workers:    1,
+					timeout:    step.timeout,
+					onTimeout:  "stop",
+					onFailure:  "stop",
+					retries:    step.Retries,
+					backoff:    time.Second,
+					outputDir:  opts.outputDir,
+					outputName: step.output,
+				}
+				if step.Retries > 0 {
+					stepOpts.onTimeout = "retry"
+					stepOpts.onFailure = "retry"
+				}
+				outcomes <- stepOutcome{name: step.Name, result: executeRun(context.Background(), &step.scriptSpec, 0, 1, stepOpts)}
+			}(step)
+		}
+
+		outcome := <-outcomes
+		running--
+		results[outcome.name] = outcome.result
+		if outcome.result.err != nil {
+			writeLog(logfile, fmt.Sprintf("Workflow %s: step %s failed: %v\n", wf.Name, outcome.name, outcome.result.err))
+			skipDependents(outcome.name, dependents, skipped)
+			continue
+		}
+
+		writeLog(logfile, fmt.Sprintf("Workflow %s: step %s completed in %v seconds\n", wf.Name, outcome.name, outcome.result.duration().Seconds()))
+		state.Completed[outcome.name] = completedStepInfo{Duration: outcome.result.duration().Seconds(), End: outcome.result.end}
+		if err := state.save(opts.stateFile); err != nil {
+			writeLog(logfile, fmt.Sprintf("Failed to save workflow state to %s: %v\n", opts.stateFile, err))
+		}
+		for _, dependent := range dependents[outcome.name] {
+			pending[dependent]--
+			if pending[dependent] == 0 && !skipped[dependent] {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	report, failed := workflowReport(wf, state, results, skipped, start)
+	writeLog(logfile, report)
+	fmt.Print(report)
+	if failed > 0 {
+		return fmt.Errorf("%d steps of workflow %s failed or were skipped, rerun with -resume to continue", failed, wf.Name)
+	}
+	if err := os.Remove(opts.stateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeLog(logfile, fmt.Sprintf("Failed to remove %s: %v\n", opts.stateFile, err))
+	}
+	return nil
+}
+
+// skipDependents marks everything downstream of a failed step as skipped.
+func skipDependents(name string, dependents map[string][]string, skipped map[string]bool) {
+	for _, dependent := range dependents[name] {
+		if !skipped[dependent] {
+			skipped[dependent] = true
+			skipDependents(dependent, dependents, skipped)
+		}
+	}
+}
+
+// workflowReport renders the per-step timings and the critical path of a
+// workflow, and counts the steps that did not complete.
+func workflowReport(wf *workflow, state *workflowState, results map[string]runResult, skipped map[string]bool, start time.Time) (string, int) {
+	var b strings.Builder
+	failed := 0
+	fmt.Fprintf(&b, "Workflow %s finished in %.3f seconds:\n", wf.Name, time.Since(start).Seconds())
+	fmt.Fprintf(&b, "  %-24s %-10s %10s %10s\n", "STEP", "STATUS", "START", "DURATION")
+
+	durations := make(map[string]float64)
+	for _, step := range wf.Steps {
+		result, ran := results[step.Name]
+		info, completed := state.Completed[step.Name]
+		switch {
+		case ran && result.err == nil:
+			durations[step.Name] = result.duration().Seconds()
+			fmt.Fprintf(&b, "  %-24s %-10s %9.3fs %9.3fs\n", step.Name, "ok", result.start.Sub(start).Seconds(), result.duration().Seconds())
+		case ran:
+			failed++
+			status := "failed"
+			if result.timedOut {
+				status = "timed out"
+			}
+			fmt.Fprintf(&b, "  %-24s %-10s %9.3fs %9.3fs\n", step.Name, status, result.start.Sub(start).Seconds(), result.duration().Seconds())
+		case completed:
+			durations[step.Name] = info.Duration
+			fmt.Fprintf(&b, "  %-24s %-10s %10s %9.3fs\n", step.Name, "resumed", "-", info.Duration)
+		default:
+			failed++
+			fmt.Fprintf(&b, "  %-24s %-10s %10s %10s\n", step.Name, "skipped", "-", "-")
+		}
+	}
+
+	path, total := criticalPath(wf.Steps, durations)
+	if len(path) > 0 {
+		fmt.Fprintf(&b, "Critical path (%.3f seconds): %s\n", total, strings.Join(path, " -> "))
+	}
+	return b.String(), failed
+}
+
+// criticalPath returns the chain of completed steps with the longest total
+// duration.
+func criticalPath(steps []workflowStep, durations map[string]float64) ([]string, float64) {
+	order, err := topologicalOrder(steps)
+	if err != nil {
+		return nil, 0
+	}
+	byName := make(map[string]*workflowStep)
+	for i := range steps {
+		byName[steps[i].Name] = &steps[i]
+	}
+
+	finish := make(map[string]float64)
+	previous := make(map[string]string)
+	last := ""
+	for _, name := range order {
+		duration, ok := durations[name]
+		if !ok {
+			continue
+		}
+		longest := 0.0
+		for _, dep := range byName[name].DependsOn {
+			if f, ok := finish[dep]; ok && f > longest {
+				longest = f
+				previous[name] = dep
+			}
+		}
+		finish[name] = longest + duration
+		if last == "" || finish[name] > finish[last] {
+			last = name
+		}
+	}
+	if last == "" {
+		return nil, 0
+	}
+
+	var path []string
+	for name := last; name != ""; name = previous[name] {
+		path = append([]string{name}, path...)
+	}
+	return path, finish[last]
+}
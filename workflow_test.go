@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSteps builds workflow steps from "name:dep1,dep2" specifications.
+func testSteps(specs ...string) []workflowStep {
+	steps := make([]workflowStep, len(specs))
+	for i, spec := range specs {
+		name, deps, _ := strings.Cut(spec, ":")
+		steps[i].Name = name
+		if deps != "" {
+			steps[i].DependsOn = strings.Split(deps, ",")
+		}
+	}
+	return steps
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []workflowStep
+		want    string
+		wantErr bool
+	}{
+		{"independent", testSteps("a", "b", "c"), "a b c", false},
+		{"chain", testSteps("c:b", "b:a", "a"), "a b c", false},
+		{"diamond", testSteps("load", "check:load", "price:load", "report:check,price"), "load check price report", false},
+		{"self cycle", testSteps("a:a"), "", true},
+		{"cycle", testSteps("a", "b:a,d", "c:b", "d:c"), "", true},
+		{"cycle without root", testSteps("a:b", "b:a"), "", true},
+	}
+	for _, tt := range tests {
+		order, err := topologicalOrder(tt.steps)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: topologicalOrder() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got := strings.Join(order, " "); got != tt.want {
+			t.Errorf("%s: topologicalOrder() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCriticalPath(t *testing.T) {
+	diamond := testSteps("load", "check:load", "price:load", "report:check,price")
+	tests := []struct {
+		name      string
+		steps     []workflowStep
+		durations map[string]float64
+		want      string
+		total     float64
+	}{
+		{"slow branch", diamond, map[string]float64{"load": 1, "check": 2, "price": 5, "report": 1}, "load price report", 7},
+		{"other branch", diamond, map[string]float64{"load": 1, "check": 6, "price": 5, "report": 1}, "load check report", 8},
+		{"incomplete", diamond, map[string]float64{"load": 1, "check": 2}, "load check", 3},
+		{"independent", testSteps("a", "b"), map[string]float64{"a": 1, "b": 3}, "b", 3},
+		{"nothing completed", diamond, nil, "", 0},
+		{"cycle", testSteps("a:b", "b:a"), map[string]float64{"a": 1, "b": 1}, "", 0},
+	}
+	for _, tt := range tests {
+		path, total := criticalPath(tt.steps, tt.durations)
+		if got := strings.Join(path, " "); got != tt.want || total != tt.total {
+			t.Errorf("%s: criticalPath() = %s, %v, want %s, %v", tt.name, got, total, tt.want, tt.total)
+		}
+	}
+}
+
+func TestLoadWorkflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", `{"steps": [{"name": "a", "script": "a.sh"}, {"name": "b", "script": "b.sh", "depends_on": ["a"]}]}`, ""},
+		{"cycle", `{"steps": [{"name": "a", "script": "a.sh", "depends_on": ["b"]}, {"name": "b", "script": "b.sh", "depends_on": ["a"]}]}`, "cycle"},
+		{"unknown dependency", `{"steps": [{"name": "a", "script": "a.sh", "depends_on": ["z"]}]}`, "unknown step"},
+		{"duplicate", `{"steps": [{"name": "a", "script": "a.sh"}, {"name": "a", "script": "b.sh"}]}`, "duplicate"},
+		{"no step", `{"steps": []}`, "does not list any step"},
+		{"same output", `{"steps": [{"name": "a b", "script": "a.sh"}, {"name": "a_b", "script": "b.sh"}]}`, "same output files"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "eod.json")
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		wf, err := loadWorkflow(path)
+		if tt.wantErr == "" {
+			if err != nil || wf.Name != "eod" {
+				t.Errorf("%s: loadWorkflow() = %v, %v, want workflow eod", tt.name, wf, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: loadWorkflow() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRunWorkflowStepOutputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"east", "west"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeScript(t, filepath.Join(dir, sub), "load.sh", "sleep 0.2\necho loaded "+sub+"\n")
+	}
+	east, west := filepath.Join(dir, "east", "load.sh"), filepath.Join(dir, "west", "load.sh")
+	data := `{"name": "eod", "steps": [{"script": "` + east + `"}, {"script": "` + west + `"}, {"name": "report", "script": "` + east + `", "args": ["again"], "depends_on": ["` + east + `", "` + west + `"]}]}`
+	workflowFile := filepath.Join(dir, "eod.json")
+	if err := os.WriteFile(workflowFile, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := workflowOptions{concurrency: 2, stateFile: filepath.Join(dir, "eod.state.json"), outputDir: filepath.Join(dir, "runs")}
+	if err := runWorkflow(workflowFile, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		stepOutputName(east) + "_run1.stdout": "loaded east\n",
+		stepOutputName(west) + "_run1.stdout": "loaded west\n",
+		"report_run1.stdout":                  "loaded east\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(opts.outputDir, name))
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, content)
+		}
+	}
+	if _, err := os.Stat(opts.stateFile); !os.IsNotExist(err) {
+		t.Errorf("state file left after success: %v", err)
+	}
+}
+
+func TestWorkflowStateSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eod.state.json")
+	if err := os.WriteFile(path, []byte(`{"workflow": "eod", "completed": {"old": {"duration": 1}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	state := &workflowState{Workflow: "eod", Completed: map[string]completedStepInfo{"load": {Duration: 2}}}
+	if err := state.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	loaded, err := loadWorkflowState(path, "eod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Completed) != 1 || loaded.Completed["load"].Duration != 2 {
+		t.Errorf("loaded state = %+v, want the saved one", loaded.Completed)
+	}
+}